@@ -0,0 +1,57 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"github.com/napptive/go-utils/pkg/connection"
+	"github.com/napptive/go-utils/pkg/printer"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/spf13/cobra"
+)
+
+// NewDiagnoseCommand creates a command that diagnoses the connection with the server configured through the
+// loader, and prints the report with the printer selected by the output type (e.g., table or json). The loader
+// flags must be registered on the command or one of its parents. The configuration is not validated on load so that
+// its violations are included in the report. The command fails if any check fails.
+func NewDiagnoseCommand(loader *connection.ConfigLoader, output *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diagnose",
+		Short: "Diagnose the connection with the server",
+		Long: "Diagnose the connection with the server resolving its address, opening a connection, verifying the " +
+			"TLS certificates, and checking the gRPC health and reflection services.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Invalid configurations are reported by the diagnostics.
+			cfg, err := loader.LoadWithoutValidation()
+			if err != nil {
+				return err
+			}
+			resultPrinter, err := printer.GetPrinter(*output)
+			if err != nil {
+				return err
+			}
+			report := connection.Diagnose(cmd.Context(), cfg)
+			if err := connection.PrintDiagnosticsReport(resultPrinter, report); err != nil {
+				return err
+			}
+			if !report.Healthy() {
+				return nerrors.NewUnavailableError("the connection diagnostics found problems")
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,307 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBreakerOpenTimeout with the default time a circuit stays open before allowing a trial call.
+const DefaultBreakerOpenTimeout = 30 * time.Second
+
+// DefaultBreakerFailureCodes with the default status codes counted as failures.
+var DefaultBreakerFailureCodes = []string{"UNAVAILABLE", "DEADLINE_EXCEEDED"}
+
+// BreakerState with the state of a circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls until the open timeout expires.
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial call through to check whether the server recovered.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (bs BreakerState) String() string {
+	switch bs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig contains the options of a circuit breaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold with the number of consecutive failures that open a circuit. Disabled if zero.
+	FailureThreshold int `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+	// SuccessThreshold with the number of consecutive successful trial calls that close a half-open circuit.
+	// Defaults to 1.
+	SuccessThreshold int `json:"successThreshold,omitempty" yaml:"successThreshold,omitempty"`
+	// OpenTimeout with the time a circuit stays open before allowing a trial call. DefaultBreakerOpenTimeout if zero.
+	OpenTimeout time.Duration `json:"openTimeout,omitempty" yaml:"openTimeout,omitempty"`
+	// FailureCodes contains the gRPC status codes (e.g., UNAVAILABLE) counted as failures. Defaults to
+	// DefaultBreakerFailureCodes.
+	FailureCodes []string `json:"failureCodes,omitempty" yaml:"failureCodes,omitempty"`
+}
+
+// Enabled returns true if the circuit breaker is enabled.
+func (bc CircuitBreakerConfig) Enabled() bool {
+	return bc.FailureThreshold > 0
+}
+
+// IsValid checks if the circuit breaker options are valid.
+func (bc CircuitBreakerConfig) IsValid() error {
+	if bc.FailureThreshold < 0 || bc.SuccessThreshold < 0 {
+		return nerrors.NewInvalidArgumentError("circuit breaker thresholds cannot be negative")
+	}
+	if bc.OpenTimeout < 0 {
+		return nerrors.NewInvalidArgumentError("circuit breaker openTimeout cannot be negative")
+	}
+	if _, err := parseCodes(bc.FailureCodes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CircuitStatus with the state of the circuit of a method.
+type CircuitStatus struct {
+	// Target of the connection.
+	Target string `json:"target"`
+	// Method with the full method name.
+	Method string `json:"method"`
+	// State of the circuit.
+	State string `json:"state"`
+	// Failures with the number of consecutive failures.
+	Failures int `json:"failures"`
+}
+
+// circuit with the state of a target and method.
+type circuit struct {
+	state     BreakerState
+	failures  int
+	successes int
+	openedAt  time.Time
+	// trial indicates that a trial call is in flight on a half-open circuit.
+	trial bool
+	// trialStartedAt with the start of the trial call. Trials not finished within the open timeout are abandoned.
+	trialStartedAt time.Time
+}
+
+// circuitKey identifies a circuit.
+type circuitKey struct {
+	target string
+	method string
+}
+
+// CircuitBreaker keeps a circuit per target and method. A circuit opens after a number of consecutive failures and
+// rejects the calls with an Unavailable error until the open timeout expires. Then, trial calls are let through
+// one at a time, closing the circuit if they succeed or opening it again if they fail.
+type CircuitBreaker struct {
+	// mu protects the circuits.
+	mu           sync.Mutex
+	config       CircuitBreakerConfig
+	failureCodes map[codes.Code]bool
+	circuits     map[circuitKey]*circuit
+	// now returns the current time. It is defined as a field so that it can be replaced in tests.
+	now func() time.Time
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with a given configuration.
+func NewCircuitBreaker(config CircuitBreakerConfig) (*CircuitBreaker, error) {
+	if err := config.IsValid(); err != nil {
+		return nil, err
+	}
+	if config.SuccessThreshold == 0 {
+		config.SuccessThreshold = 1
+	}
+	if config.OpenTimeout == 0 {
+		config.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if len(config.FailureCodes) == 0 {
+		config.FailureCodes = DefaultBreakerFailureCodes
+	}
+	failureCodes, err := parseCodes(config.FailureCodes)
+	if err != nil {
+		return nil, err
+	}
+	return &CircuitBreaker{
+		config:       config,
+		failureCodes: failureCodes,
+		circuits:     make(map[circuitKey]*circuit),
+		now:          time.Now,
+	}, nil
+}
+
+// DialOptions returns the dial options that install the unary and stream circuit breaker interceptors.
+func (cb *CircuitBreaker) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		WithUnaryInterceptors(cb.UnaryClientInterceptor()),
+		WithStreamInterceptors(cb.StreamClientInterceptor()),
+	}
+}
+
+// State returns the state of the circuit of a target and method.
+func (cb *CircuitBreaker) State(target string, method string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if c, exists := cb.circuits[circuitKey{target: target, method: method}]; exists {
+		return cb.currentState(c)
+	}
+	return BreakerClosed
+}
+
+// States returns the state of all the circuits sorted by target and method.
+func (cb *CircuitBreaker) States() []CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	result := make([]CircuitStatus, 0, len(cb.circuits))
+	for key, c := range cb.circuits {
+		result = append(result, CircuitStatus{Target: key.target, Method: key.method, State: cb.currentState(c).String(), Failures: c.failures})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Target != result[j].Target {
+			return result[i].Target < result[j].Target
+		}
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
+
+// currentState returns the state of a circuit taking into account the open timeout.
+func (cb *CircuitBreaker) currentState(c *circuit) BreakerState {
+	if c.state == BreakerOpen && cb.now().Sub(c.openedAt) >= cb.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return c.state
+}
+
+// allow checks if a call can proceed, returning an Unavailable error if the circuit is open.
+func (cb *CircuitBreaker) allow(target string, method string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	key := circuitKey{target: target, method: method}
+	c, exists := cb.circuits[key]
+	if !exists {
+		c = &circuit{state: BreakerClosed}
+		cb.circuits[key] = c
+	}
+	c.state = cb.currentState(c)
+	switch c.state {
+	case BreakerOpen:
+		return nerrors.NewUnavailableError("circuit breaker is open for %s on %s", method, target).ToGRPC()
+	case BreakerHalfOpen:
+		if c.trial && cb.now().Sub(c.trialStartedAt) < cb.config.OpenTimeout {
+			return nerrors.NewUnavailableError("circuit breaker is half-open for %s on %s", method, target).ToGRPC()
+		}
+		c.trial = true
+		c.trialStartedAt = cb.now()
+	}
+	return nil
+}
+
+// record updates the circuit with the result of a call.
+func (cb *CircuitBreaker) record(target string, method string, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, exists := cb.circuits[circuitKey{target: target, method: method}]
+	if !exists {
+		return
+	}
+	failed := err != nil && cb.failureCodes[status.Code(err)]
+	switch c.state {
+	case BreakerClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= cb.config.FailureThreshold {
+			cb.open(target, method, c)
+		}
+	case BreakerHalfOpen:
+		c.trial = false
+		if failed {
+			c.failures++
+			cb.open(target, method, c)
+			return
+		}
+		c.successes++
+		if c.successes >= cb.config.SuccessThreshold {
+			log.Info().Str("target", target).Str("method", method).Msg("circuit breaker closed")
+			c.state = BreakerClosed
+			c.failures = 0
+			c.successes = 0
+		}
+	}
+}
+
+// open opens a circuit.
+func (cb *CircuitBreaker) open(target string, method string, c *circuit) {
+	log.Warn().Str("target", target).Str("method", method).Int("failures", c.failures).Msg("circuit breaker opened")
+	c.state = BreakerOpen
+	c.openedAt = cb.now()
+	c.successes = 0
+	c.trial = false
+}
+
+// UnaryClientInterceptor returns a client interceptor that rejects the calls while their circuit is open.
+func (cb *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		target := cc.Target()
+		if err := cb.allow(target, method); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cb.record(target, method, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor that rejects the streams while their circuit is open. The
+// result of a stream is recorded when the stream finishes.
+func (cb *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		target := cc.Target()
+		if err := cb.allow(target, method); err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cb.record(target, method, err)
+			return nil, err
+		}
+		return &observedStream{ClientStream: stream, desc: desc, method: method, start: time.Now(), onFinish: func(method string, err error, _ time.Duration) {
+			cb.record(target, method, err)
+		}}, nil
+	}
+}
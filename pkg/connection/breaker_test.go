@@ -0,0 +1,126 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Circuit breaker", func() {
+
+	const target = "catalog:443"
+	const method = "/catalog.Catalog/List"
+
+	var breaker *CircuitBreaker
+	var now time.Time
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		breaker, err = NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, SuccessThreshold: 2, OpenTimeout: time.Minute})
+		gomega.Expect(err).To(gomega.Succeed())
+		now = time.Now()
+		breaker.now = func() time.Time { return now }
+	})
+
+	call := func(err error) error {
+		if allowErr := breaker.allow(target, method); allowErr != nil {
+			return allowErr
+		}
+		breaker.record(target, method, err)
+		return err
+	}
+
+	ginkgo.It("should open after consecutive failures and fail fast", func() {
+		gomega.Expect(call(unavailable)).To(gomega.Equal(unavailable))
+		gomega.Expect(call(nil)).To(gomega.Succeed())
+		gomega.Expect(call(unavailable)).To(gomega.Equal(unavailable))
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerClosed))
+		gomega.Expect(call(unavailable)).To(gomega.Equal(unavailable))
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerOpen))
+
+		err := call(nil)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(nerrors.FromGRPC(err).Code).To(gomega.Equal(nerrors.Unavailable))
+		gomega.Expect(breaker.State(target, "/catalog.Catalog/Get")).To(gomega.Equal(BreakerClosed))
+		gomega.Expect(breaker.States()).To(gomega.Equal([]CircuitStatus{{Target: target, Method: method, State: "open", Failures: 2}}))
+	})
+
+	ginkgo.It("should ignore the codes not counted as failures", func() {
+		for i := 0; i < 3; i++ {
+			gomega.Expect(call(status.Error(codes.NotFound, "missing"))).ToNot(gomega.Succeed())
+		}
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerClosed))
+	})
+
+	ginkgo.It("should close after successful trial calls", func() {
+		_ = call(unavailable)
+		_ = call(unavailable)
+		now = now.Add(time.Minute)
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerHalfOpen))
+
+		gomega.Expect(breaker.allow(target, method)).To(gomega.Succeed())
+		gomega.Expect(breaker.allow(target, method)).ToNot(gomega.Succeed())
+		breaker.record(target, method, nil)
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerHalfOpen))
+		gomega.Expect(call(nil)).To(gomega.Succeed())
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerClosed))
+	})
+
+	ginkgo.It("should open again if the trial call fails", func() {
+		_ = call(unavailable)
+		_ = call(unavailable)
+		now = now.Add(time.Minute)
+		gomega.Expect(call(unavailable)).To(gomega.Equal(unavailable))
+		gomega.Expect(breaker.State(target, method)).To(gomega.Equal(BreakerOpen))
+	})
+
+	ginkgo.It("should reject invalid options", func() {
+		_, err := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, FailureCodes: []string{"NOT_A_CODE"}})
+		gomega.Expect(err).ToNot(gomega.Succeed())
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7060, CircuitBreaker: CircuitBreakerConfig{FailureThreshold: -1}}
+		gomega.Expect(cfg.IsValid().Error()).To(gomega.ContainSubstring("circuitBreaker"))
+	})
+
+	ginkgo.It("should protect the calls of a connection", func() {
+		healthServer := &flakyHealthServer{failures: 10}
+		server, dialer := startBufconnServer(healthServer)
+		defer server.Stop()
+		opts := append(breaker.DialOptions(), dialer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := GetConnection(&Config{ServerAddress: "bufnet", ServerPort: 443}, opts...)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+
+		client := grpc_health_v1.NewHealthClient(conn)
+		for i := 0; i < 4; i++ {
+			_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+			gomega.Expect(err).ToNot(gomega.Succeed())
+		}
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+		gomega.Expect(breaker.State(conn.Target(), "/grpc.health.v1.Health/Check")).To(gomega.Equal(BreakerOpen))
+	})
+})
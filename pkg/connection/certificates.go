@@ -0,0 +1,183 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// pemPrefix with the prefix of PEM encoded content.
+const pemPrefix = "-----BEGIN"
+
+// loadPEM returns the PEM content of an element (e.g., CA) given as raw PEM, base64 encoded PEM, or the path of a
+// file containing any of the previous, together with a description of the source used in errors.
+func loadPEM(value string, element string) ([]byte, string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, pemPrefix) {
+		return []byte(value), "PEM content", nil
+	}
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return nil, "", nerrors.NewInvalidArgumentErrorFrom(err, "cannot read %s file %s", element, value)
+		}
+		if !bytes.Contains(content, []byte(pemPrefix)) {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+			if err != nil {
+				return nil, "", nerrors.NewInvalidArgumentErrorFrom(err, "%s file %s is neither PEM nor base64 encoded", element, value)
+			}
+			content = decoded
+		}
+		return content, "file " + value, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, "", nerrors.NewInvalidArgumentErrorFrom(err, "%s is neither PEM, base64 encoded PEM, nor an existing file", element)
+	}
+	return decoded, "base64 content", nil
+}
+
+// parseClientCA returns the certificates contained in a CA given as raw PEM, base64 encoded PEM, or a file path.
+// Multiple PEM blocks are accepted, and errors report the position of the certificate that cannot be parsed.
+func parseClientCA(clientCA string) ([]*x509.Certificate, error) {
+	content, source, err := loadPEM(clientCA, "CA")
+	if err != nil {
+		return nil, err
+	}
+	certificates := make([]*x509.Certificate, 0)
+	rest := content
+	for index := 0; ; index++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot parse CA certificate #%d of %s", index+1, source)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, nerrors.NewInvalidArgumentError("CA %s does not contain any PEM encoded certificate", source)
+	}
+	return certificates, nil
+}
+
+// getCertPool returns the pool with the CAs trusted to validate the server certificate. The custom CAs are added to
+// the system pool if mergeSystem is set.
+func getCertPool(clientCA string, mergeSystem bool) (*x509.CertPool, error) {
+	certificates, err := parseClientCA(clientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if mergeSystem {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot load the system certificate pool, using only the custom CAs")
+		} else {
+			pool = systemPool
+		}
+	}
+	for _, certificate := range certificates {
+		pool.AddCert(certificate)
+	}
+	return pool, nil
+}
+
+// tlsVersions with the supported values of the MinTLSVersion option.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the TLS version identifier of a version name, or zero if it is empty.
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	result, exists := tlsVersions[strings.TrimPrefix(strings.ToUpper(version), "TLS")]
+	if !exists {
+		return 0, nerrors.NewInvalidArgumentError("unsupported TLS version %s, expecting 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return result, nil
+}
+
+// parseCipherSuites returns the identifiers of a list of cipher suite names. Only the suites considered secure by
+// the Go TLS library are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	result := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, exists := available[name]
+		if !exists {
+			return nil, nerrors.NewInvalidArgumentError("unsupported or insecure cipher suite %s", name)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+// getTLSConfig returns the TLS configuration used to connect with the server.
+func getTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.SkipCertValidation,
+		ServerName:         cfg.ServerName,
+	}
+	minVersion, err := parseTLSVersion(cfg.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.MinVersion = minVersion
+	if len(cfg.CipherSuites) > 0 {
+		cipherSuites, err := parseCipherSuites(cfg.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = cipherSuites
+	}
+	if cfg.ClientCA != "" {
+		pool, err := getCertPool(cfg.ClientCA, cfg.MergeSystemCAs)
+		if err != nil {
+			return nil, err
+		}
+		// add the CA as valid one
+		tlsConfig.RootCAs = pool
+	}
+	if err := applyPinning(cfg, tlsConfig); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,159 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Client CA handling", func() {
+
+	var dir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "certificates")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept raw PEM, base64 and file paths", func() {
+		bundle := append(newTestCA(), newTestCA()...)
+		pemPath := filepath.Join(dir, "ca.pem")
+		gomega.Expect(os.WriteFile(pemPath, bundle, 0600)).To(gomega.Succeed())
+		base64Path := filepath.Join(dir, "ca.b64")
+		gomega.Expect(os.WriteFile(base64Path, []byte(base64.StdEncoding.EncodeToString(bundle)+"\n"), 0600)).To(gomega.Succeed())
+
+		for _, ca := range []string{string(bundle), base64.StdEncoding.EncodeToString(bundle), pemPath, base64Path} {
+			certificates, err := parseClientCA(ca)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(certificates).To(gomega.HaveLen(2))
+		}
+	})
+
+	ginkgo.It("should report the certificate that cannot be parsed", func() {
+		invalid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")})
+		_, err := parseClientCA(string(append(newTestCA(), invalid...)))
+		gomega.Expect(err).ToNot(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("#2"))
+
+		_, err = parseClientCA(filepath.Join(dir, "missing.pem"))
+		gomega.Expect(err).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should validate the server with the custom CA merged with the system pool", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"message":"merged"}`))
+		}))
+		defer server.Close()
+		cfg := &Config{
+			ServerAddress:  "127.0.0.1",
+			ServerPort:     server.Listener.Addr().(*net.TCPAddr).Port,
+			UseTLS:         true,
+			ClientCA:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+			MergeSystemCAs: true,
+		}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+		client, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(client.GetJSON(context.Background(), "/", &testMessage{})).To(gomega.Succeed())
+	})
+
+	ginkgo.Context("TLS options", func() {
+
+		var server *httptest.Server
+		var versions chan uint16
+		var cfg *Config
+
+		ginkgo.BeforeEach(func() {
+			versions = make(chan uint16, 1)
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				versions <- r.TLS.Version
+				_, _ = w.Write([]byte(`{"message":"tls"}`))
+			}))
+			cfg = &Config{
+				ServerAddress: "127.0.0.1",
+				ServerPort:    server.Listener.Addr().(*net.TCPAddr).Port,
+				UseTLS:        true,
+				ClientCA:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+			}
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Close()
+		})
+
+		get := func() error {
+			client, err := NewHTTPClient(cfg, HTTPOptions{})
+			gomega.Expect(err).To(gomega.Succeed())
+			return client.GetJSON(context.Background(), "/", &testMessage{})
+		}
+
+		ginkgo.It("should apply the minimum TLS version", func() {
+			cfg.MinTLSVersion = "1.3"
+			gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+			gomega.Expect(get()).To(gomega.Succeed())
+			gomega.Expect(versions).To(gomega.Receive(gomega.Equal(uint16(tls.VersionTLS13))))
+		})
+
+		ginkgo.It("should validate the certificate against the server name override", func() {
+			cfg.ServerName = "example.com"
+			gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+			gomega.Expect(get()).To(gomega.Succeed())
+			cfg.ServerName = "other.example.org"
+			gomega.Expect(get()).ToNot(gomega.Succeed())
+		})
+
+		ginkgo.It("should restrict the cipher suites", func() {
+			cfg.MinTLSVersion = "TLS1.2"
+			cfg.CipherSuites = []string{tls.CipherSuiteName(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)}
+			gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+			tlsConfig, err := getTLSConfig(cfg)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(tlsConfig.CipherSuites).To(gomega.Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+			gomega.Expect(tlsConfig.MinVersion).To(gomega.Equal(uint16(tls.VersionTLS12)))
+		})
+
+		ginkgo.It("should reject invalid TLS options", func() {
+			cfg.UseTLS = false
+			cfg.MinTLSVersion = "1.3"
+			cfg.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+			cfg.ServerName = "invalid name"
+			err := cfg.IsValid()
+			gomega.Expect(err).ToNot(gomega.Succeed())
+			for _, field := range []string{"useTLS", "cipherSuites", "serverName"} {
+				gomega.Expect(err.Error()).To(gomega.ContainSubstring(field))
+			}
+			cfg.MinTLSVersion = "1.4"
+			gomega.Expect(cfg.IsValid().Error()).To(gomega.ContainSubstring("minTLSVersion"))
+		})
+	})
+})
@@ -0,0 +1,125 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientInfo contains the agent and version reported by a client through the AgentHeader and VersionHeader metadata.
+type ClientInfo struct {
+	// Agent sending the request.
+	Agent string
+	// Version of the application sending the request.
+	Version string
+}
+
+// clientInfoKey is the context key of the ClientInfo.
+type clientInfoKey struct{}
+
+// ContextWithClientInfo returns a context carrying the given client information.
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the client information extracted by the ClientInfo interceptors.
+func ClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info, ok
+}
+
+// clientInfoFromMetadata extracts the client information from the incoming metadata.
+func clientInfoFromMetadata(ctx context.Context) ClientInfo {
+	md, _ := metadata.FromIncomingContext(ctx)
+	info := ClientInfo{}
+	if values := md.Get(AgentHeader); len(values) > 0 {
+		info.Agent = values[0]
+	}
+	if values := md.Get(VersionHeader); len(values) > 0 {
+		info.Version = values[0]
+	}
+	return info
+}
+
+// checkClientVersion checks that the client version is not below the minimum version. Clients that do not report a
+// valid semantic version are accepted, as they cannot be compared.
+func checkClientVersion(method string, info ClientInfo, minVersion *Version) error {
+	if minVersion == nil || info.Version == "" {
+		return nil
+	}
+	version, err := ParseVersion(info.Version)
+	if err != nil {
+		log.Debug().Str("method", method).Str("agent", info.Agent).Str("version", info.Version).Msg("cannot parse client version")
+		return nil
+	}
+	if version.LessThan(*minVersion) {
+		return nerrors.NewFailedPreconditionError("%s %s is no longer supported, please upgrade to %s or later",
+			info.Agent, version, minVersion).ToGRPC()
+	}
+	return nil
+}
+
+// processClientInfo extracts, logs and checks the client information of a call, returning the context to use in
+// the handler.
+func processClientInfo(ctx context.Context, method string, minVersion *Version) (context.Context, error) {
+	info := clientInfoFromMetadata(ctx)
+	log.Debug().Str("method", method).Str("agent", info.Agent).Str("version", info.Version).Msg("client info")
+	if err := checkClientVersion(method, info, minVersion); err != nil {
+		return nil, err
+	}
+	return ContextWithClientInfo(ctx, info), nil
+}
+
+// ClientInfoUnaryServerInterceptor returns a server interceptor that stores the ClientInfo in the context of the
+// handler. If minVersion is set, clients reporting a lower version are rejected with a FailedPrecondition error.
+func ClientInfoUnaryServerInterceptor(minVersion *Version) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := processClientInfo(ctx, info.FullMethod, minVersion)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ClientInfoStreamServerInterceptor returns a server interceptor that stores the ClientInfo in the context of the
+// stream. If minVersion is set, clients reporting a lower version are rejected with a FailedPrecondition error.
+func ClientInfoStreamServerInterceptor(minVersion *Version) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := processClientInfo(ss.Context(), info.FullMethod, minVersion)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextServerStream is a grpc.ServerStream with a replaced context.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
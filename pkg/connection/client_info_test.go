@@ -0,0 +1,99 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = ginkgo.Describe("Client info interceptors", func() {
+
+	ginkgo.It("should store the client information in the context", func() {
+		md := metadata.New(map[string]string{AgentHeader: "playground", VersionHeader: "v1.2.0"})
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		var received ClientInfo
+		interceptor := ClientInfoUnaryServerInterceptor(nil)
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				info, found := ClientInfoFromContext(ctx)
+				gomega.Expect(found).To(gomega.BeTrue())
+				received = info
+				return nil, nil
+			})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(received).To(gomega.Equal(ClientInfo{Agent: "playground", Version: "v1.2.0"}))
+	})
+
+	ginkgo.Context("with a minimum version", func() {
+
+		var server *Server
+		var conn *grpc.ClientConn
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			server, err = NewServer(&ServerConfig{ListenAddress: "127.0.0.1:0", MinClientVersion: "v1.2.0"})
+			gomega.Expect(err).To(gomega.Succeed())
+			listener := bufconn.Listen(1024 * 1024)
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			conn, err = grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					return listener.DialContext(ctx)
+				}))
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			gomega.Expect(conn.Close()).To(gomega.Succeed())
+			server.Stop()
+		})
+
+		check := func(version string) error {
+			ctx, cancel := NewContextHelper(version, "playground", nil).GetContext()
+			defer cancel()
+			ctx, timeoutCancel := context.WithTimeout(ctx, 5*time.Second)
+			defer timeoutCancel()
+			_, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			return err
+		}
+
+		ginkgo.It("should reject older clients", func() {
+			err := check("v1.1.9")
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.FailedPrecondition))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("please upgrade to v1.2.0"))
+		})
+
+		ginkgo.It("should accept supported and unversioned clients", func() {
+			gomega.Expect(check("v1.2.0")).To(gomega.Succeed())
+			gomega.Expect(check("v2.0.0")).To(gomega.Succeed())
+			gomega.Expect(check("")).To(gomega.Succeed())
+		})
+	})
+})
@@ -17,48 +17,219 @@
 package connection
 
 import (
-	"fmt"
+	"crypto/tls"
+	"time"
 
 	"github.com/napptive/go-utils/pkg/validation"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/encoding"
+	// Register the gzip compressor so that it can be selected as the default compression.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/resolver"
 )
 
+// MinKeepaliveTime with the minimum keepalive time accepted by gRPC clients.
+const MinKeepaliveTime = 10 * time.Second
+
+// MinWindowSize with the minimum flow control window size accepted by gRPC.
+const MinWindowSize = 64 * 1024
+
+// DefaultConnectTimeout with the default timeout of blocking dials.
+const DefaultConnectTimeout = 20 * time.Second
+
 // Config contains the configuration elements related to the connection with gRPC services.
 type Config struct {
 	// Name of the connection as user information.
-	Name string
-	// ServerAddress with the dns/IP of the target gRPC server.
-	ServerAddress string
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// ServerAddress with the dns/IP of the target gRPC server. IPv6 literals are accepted with or without brackets.
+	// A full gRPC target URI (e.g., dns:///host:port, unix:///path/to/socket) may be used instead, in which case the
+	// ServerPort is only used to complete dns targets without a port. Only the registered resolvers are accepted.
+	ServerAddress string `json:"serverAddress,omitempty" yaml:"serverAddress,omitempty"`
 	// ServerPort with the port of the catalog-manager gRPC server.
-	ServerPort int
+	ServerPort int `json:"serverPort,omitempty" yaml:"serverPort,omitempty"`
+	// LoadBalancingPolicy with the client-side load balancing policy (e.g., round_robin). When set on a plain
+	// address, the address is resolved with the dns resolver so that the policy balances among all its IPs, unless
+	// the server is reached through a proxy.
+	LoadBalancingPolicy string `json:"loadBalancingPolicy,omitempty" yaml:"loadBalancingPolicy,omitempty"`
 	// AuthEnable with a flag to indicate if the authentication is enabled or not
-	AuthEnable bool
+	AuthEnable bool `json:"authEnable,omitempty" yaml:"authEnable,omitempty"`
 	// UseTLS indicates that a TLS connection is expected with the service.
-	UseTLS bool
+	UseTLS bool `json:"useTLS,omitempty" yaml:"useTLS,omitempty"`
 	// SkipCertValidation flag that enables ignoring the validation step of the certificate presented by the server.
-	SkipCertValidation bool
-	// ClientCA with a client trusted CA
-	ClientCA string
+	SkipCertValidation bool `json:"skipCertValidation,omitempty" yaml:"skipCertValidation,omitempty"`
+	// ClientCA with the CAs trusted to validate the server certificate, given as raw PEM, base64 encoded PEM, or the
+	// path of a file. Multiple PEM blocks are accepted. The CAs replace the system pool unless MergeSystemCAs is set.
+	ClientCA string `json:"clientCA,omitempty" yaml:"clientCA,omitempty" redact:"true"`
+	// MergeSystemCAs adds the ClientCA to the system certificate pool instead of replacing it, so that both private
+	// and public endpoints can be validated.
+	MergeSystemCAs bool `json:"mergeSystemCAs,omitempty" yaml:"mergeSystemCAs,omitempty"`
+	// MinTLSVersion with the minimum TLS version accepted (1.0, 1.1, 1.2 or 1.3). Go default if empty.
+	MinTLSVersion string `json:"minTLSVersion,omitempty" yaml:"minTLSVersion,omitempty"`
+	// CipherSuites with the allowlist of TLS 1.0-1.2 cipher suites using their standard names (e.g.,
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256). TLS 1.3 suites are not configurable. Go default if empty.
+	CipherSuites []string `json:"cipherSuites,omitempty" yaml:"cipherSuites,omitempty"`
+	// ServerName overrides the name sent in the SNI extension and used to validate the server certificate.
+	// The host of the server address is used if empty.
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	// CertificatePins with the SHA-256 pins of the server certificates, either SPKI pins (sha256/<base64>) or
+	// certificate fingerprints (sha256:<hex>). A pinned server certificate is accepted even if its chain is not
+	// trusted. Pins of intermediate or root certificates require the chain to be trusted by the configured CAs.
+	CertificatePins []string `json:"certificatePins,omitempty" yaml:"certificatePins,omitempty"`
+	// TrustOnFirstUse accepts the server certificate on the first connection if no pins are set, and reports its
+	// SPKI pin to the PinRecorder so that it can be verified on the next connections.
+	TrustOnFirstUse bool `json:"trustOnFirstUse,omitempty" yaml:"trustOnFirstUse,omitempty"`
+	// PinRecorder is called with the pin accepted in trust on first use mode (e.g., ProfilePinRecorder).
+	PinRecorder PinRecorder `json:"-" yaml:"-"`
+	// Retry with the retry options applied to the calls.
+	Retry RetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// RateLimit with the client-side rate and concurrency limits applied to the calls.
+	RateLimit RateLimitConfig `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	// CircuitBreaker with the circuit breaker options. GetConnection creates a breaker per connection; use
+	// NewCircuitBreaker and its DialOptions instead to share the breaker or access the state of its circuits.
+	CircuitBreaker CircuitBreakerConfig `json:"circuitBreaker,omitempty" yaml:"circuitBreaker,omitempty"`
+	// Timeouts with the per method timeouts applied to the calls whose context has no deadline.
+	Timeouts TimeoutConfig `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+	// Hedging with the hedging options applied to idempotent read methods.
+	Hedging HedgingConfig `json:"hedging,omitempty" yaml:"hedging,omitempty"`
+	// KeepaliveTime with the period of inactivity after which the client pings the server. Disabled if zero.
+	KeepaliveTime time.Duration `json:"keepaliveTime,omitempty" yaml:"keepaliveTime,omitempty"`
+	// KeepaliveTimeout with the time the client waits for a ping acknowledgement before closing the connection.
+	KeepaliveTimeout time.Duration `json:"keepaliveTimeout,omitempty" yaml:"keepaliveTimeout,omitempty"`
+	// KeepalivePermitWithoutStream enables sending pings even when there are no active calls.
+	KeepalivePermitWithoutStream bool `json:"keepalivePermitWithoutStream,omitempty" yaml:"keepalivePermitWithoutStream,omitempty"`
+	// MaxSendMsgSize with the maximum size in bytes of the messages sent to the server. gRPC default if zero.
+	MaxSendMsgSize int `json:"maxSendMsgSize,omitempty" yaml:"maxSendMsgSize,omitempty"`
+	// MaxRecvMsgSize with the maximum size in bytes of the messages received from the server. gRPC default if zero.
+	MaxRecvMsgSize int `json:"maxRecvMsgSize,omitempty" yaml:"maxRecvMsgSize,omitempty"`
+	// Compression with the name of the compressor used by default on the calls (e.g., gzip). Disabled if empty.
+	Compression string `json:"compression,omitempty" yaml:"compression,omitempty"`
+	// InitialWindowSize with the initial flow control window size of each stream. gRPC default if zero.
+	InitialWindowSize int32 `json:"initialWindowSize,omitempty" yaml:"initialWindowSize,omitempty"`
+	// InitialConnWindowSize with the initial flow control window size of the connection. gRPC default if zero.
+	InitialConnWindowSize int32 `json:"initialConnWindowSize,omitempty" yaml:"initialConnWindowSize,omitempty"`
+	// BlockingDial makes GetConnection wait until the connection is established.
+	BlockingDial bool `json:"blockingDial,omitempty" yaml:"blockingDial,omitempty"`
+	// ConnectTimeout with the maximum time to wait for the connection on blocking dials. DefaultConnectTimeout if zero.
+	ConnectTimeout time.Duration `json:"connectTimeout,omitempty" yaml:"connectTimeout,omitempty"`
+	// Proxy with the HTTP CONNECT proxy used to reach the server.
+	Proxy ProxyConfig `json:"proxy,omitempty" yaml:"proxy,omitempty"`
 }
 
-// IsValid checks if the configuration options are valid.
+// IsValid checks if the configuration options are valid. All the problems found are returned together in an
+// InvalidArgument error whose cause contains the validation.FieldViolations.
 func (cc *Config) IsValid() error {
-	if err := validation.CheckNotEmpty(cc.ServerAddress, "serverAddress"); err != nil {
-		return err
+	violations := validation.NewViolations()
+	cc.checkAddress(violations)
+	if cc.ClientCA != "" {
+		if _, err := parseClientCA(cc.ClientCA); err != nil {
+			violations.Check("clientCA", err)
+		}
+		if cc.SkipCertValidation {
+			violations.Add("skipCertValidation", "cannot skip the certificate validation when a clientCA is set")
+		}
 	}
-	if err := validation.CheckPositive(cc.ServerPort, "serverPort"); err != nil {
-		return err
+	cc.checkTLSOptions(violations)
+	if len(cc.CertificatePins) > 0 || cc.TrustOnFirstUse {
+		if _, err := parsePins(cc.CertificatePins); err != nil {
+			violations.Check("certificatePins", err)
+		}
+		if !cc.UseTLS {
+			violations.Add("useTLS", "TLS is required to verify certificate pins")
+		}
+		if cc.SkipCertValidation {
+			violations.Add("skipCertValidation", "cannot skip the certificate validation when pinning certificates")
+		}
 	}
+	if cc.AuthEnable && !cc.UseTLS {
+		violations.Add("useTLS", "TLS is required when authentication is enabled")
+	}
+	violations.Check("retry", cc.Retry.IsValid())
+	violations.Check("rateLimit", cc.RateLimit.IsValid())
+	violations.Check("circuitBreaker", cc.CircuitBreaker.IsValid())
+	violations.Check("timeouts", cc.Timeouts.IsValid())
+	violations.Check("hedging", cc.Hedging.IsValid())
+	violations.Check("hedging", cc.Hedging.checkRetryOverlap(cc.Retry))
+	violations.Check("proxy", cc.Proxy.IsValid())
+	cc.checkTransportOptions(violations)
 
-	return nil
+	return violations.ToError("invalid connection configuration")
 }
 
-// Print the configuration using the application logger.
-func (cc *Config) Print() {
-	log.Info().Str("name", cc.Name).Str("server", cc.ServerAddress).Int("Port", cc.ServerPort).Bool("useTLS", cc.UseTLS).Bool("skipCertValidation", cc.SkipCertValidation).Msg("Connection options")
+// checkTLSOptions checks the TLS version, cipher suites and server name options.
+func (cc *Config) checkTLSOptions(violations *validation.Violations) {
+	if cc.MinTLSVersion == "" && len(cc.CipherSuites) == 0 && cc.ServerName == "" {
+		return
+	}
+	if !cc.UseTLS {
+		violations.Add("useTLS", "TLS is required to apply the TLS options")
+	}
+	minVersion, err := parseTLSVersion(cc.MinTLSVersion)
+	violations.Check("minTLSVersion", err)
+	if len(cc.CipherSuites) > 0 {
+		_, err := parseCipherSuites(cc.CipherSuites)
+		violations.Check("cipherSuites", err)
+		if minVersion == tls.VersionTLS13 {
+			violations.Add("cipherSuites", "cipher suites cannot be configured for TLS 1.3")
+		}
+	}
+	if cc.ServerName != "" {
+		violations.Check("serverName", validation.CheckHost(cc.ServerName, "serverName"))
+	}
 }
 
-// GetEffectiveAddress returns an address:port string.
-func (cc *Config) GetEffectiveAddress() string {
-	return fmt.Sprintf("%s:%d", cc.ServerAddress, cc.ServerPort)
+// checkAddress checks the server address, port, and load balancing options.
+func (cc *Config) checkAddress(violations *validation.Violations) {
+	if err := validation.CheckNotEmpty(cc.ServerAddress, "serverAddress"); err != nil {
+		violations.Check("serverAddress", err)
+	} else if scheme, _, isURI := parseTarget(cc.ServerAddress); isURI {
+		if resolver.Get(scheme) == nil {
+			violations.Add("serverAddress", "no resolver is registered for scheme %s", scheme)
+		}
+		if cc.ServerPort != 0 {
+			violations.Check("serverPort", validation.CheckPort(cc.ServerPort, "serverPort"))
+		}
+	} else {
+		violations.Check("serverAddress", validation.CheckHost(trimBrackets(cc.ServerAddress), "serverAddress"))
+		violations.Check("serverPort", validation.CheckPort(cc.ServerPort, "serverPort"))
+	}
+	if cc.LoadBalancingPolicy != "" && balancer.Get(cc.LoadBalancingPolicy) == nil {
+		violations.Add("loadBalancingPolicy", "%s is not supported", cc.LoadBalancingPolicy)
+	}
+}
+
+// checkTransportOptions checks the keepalive, message size, compression, and flow control options.
+func (cc *Config) checkTransportOptions(violations *validation.Violations) {
+	if cc.KeepaliveTime != 0 && cc.KeepaliveTime < MinKeepaliveTime {
+		violations.Add("keepaliveTime", "must be at least %s", MinKeepaliveTime)
+	}
+	if cc.KeepaliveTimeout < 0 {
+		violations.Add("keepaliveTimeout", "cannot be negative")
+	}
+	if cc.KeepaliveTime == 0 && (cc.KeepaliveTimeout != 0 || cc.KeepalivePermitWithoutStream) {
+		violations.Add("keepaliveTime", "is required to enable keepalive options")
+	}
+	if cc.MaxSendMsgSize < 0 {
+		violations.Add("maxSendMsgSize", "cannot be negative")
+	}
+	if cc.MaxRecvMsgSize < 0 {
+		violations.Add("maxRecvMsgSize", "cannot be negative")
+	}
+	if cc.Compression != "" && encoding.GetCompressor(cc.Compression) == nil {
+		violations.Add("compression", "%s is not supported", cc.Compression)
+	}
+	if cc.InitialWindowSize != 0 && cc.InitialWindowSize < MinWindowSize {
+		violations.Add("initialWindowSize", "must be at least %d bytes", MinWindowSize)
+	}
+	if cc.InitialConnWindowSize != 0 && cc.InitialConnWindowSize < MinWindowSize {
+		violations.Add("initialConnWindowSize", "must be at least %d bytes", MinWindowSize)
+	}
+	if cc.ConnectTimeout < 0 {
+		violations.Add("connectTimeout", "cannot be negative")
+	}
+}
+
+// Print the configuration using the application logger. Sensitive fields are redacted.
+func (cc *Config) Print() {
+	log.Info().EmbedObject(cc).Msg("Connection options")
 }
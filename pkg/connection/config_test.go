@@ -0,0 +1,117 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/napptive/go-utils/pkg/validation"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// newTestCA generates a self-signed CA certificate and returns it PEM encoded.
+func newTestCA() []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+var _ = ginkgo.Describe("Connection configuration", func() {
+
+	var cfg *Config
+
+	ginkgo.BeforeEach(func() {
+		cfg = &Config{ServerAddress: "localhost", ServerPort: 7060}
+	})
+
+	ginkgo.It("should accept valid transport options", func() {
+		cfg.KeepaliveTime = time.Minute
+		cfg.KeepaliveTimeout = 20 * time.Second
+		cfg.MaxRecvMsgSize = 16 * 1024 * 1024
+		cfg.Compression = "gzip"
+		cfg.InitialWindowSize = 1024 * 1024
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+		gomega.Expect(getTransportDialOptions(cfg)).To(gomega.HaveLen(3))
+	})
+
+	ginkgo.It("should reject a keepalive time below the minimum", func() {
+		cfg.KeepaliveTime = time.Second
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject keepalive options without keepalive time", func() {
+		cfg.KeepaliveTimeout = time.Second
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject unsupported compressors", func() {
+		cfg.Compression = "zstd"
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject small window sizes", func() {
+		cfg.InitialConnWindowSize = 1024
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject negative message sizes", func() {
+		cfg.MaxSendMsgSize = -1
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept a valid CA", func() {
+		cfg.UseTLS = true
+		cfg.ClientCA = base64.StdEncoding.EncodeToString(newTestCA())
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should report all the violations together", func() {
+		cfg.ServerAddress = "invalid_host"
+		cfg.ServerPort = 70000
+		cfg.ClientCA = base64.StdEncoding.EncodeToString([]byte("not a certificate"))
+		cfg.SkipCertValidation = true
+		cfg.AuthEnable = true
+		err := cfg.IsValid()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		fields := make([]string, 0)
+		for _, violation := range validation.GetFieldViolations(err) {
+			fields = append(fields, violation.Field)
+		}
+		gomega.Expect(fields).To(gomega.Equal([]string{"serverAddress", "serverPort", "clientCA", "skipCertValidation", "useTLS"}))
+	})
+
+})
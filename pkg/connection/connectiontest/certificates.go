@@ -0,0 +1,116 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectiontest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// CertificateValidity with the validity of the generated certificates.
+const CertificateValidity = 24 * time.Hour
+
+// Certificates contains a self-signed CA and a server certificate signed by it, all PEM encoded.
+type Certificates struct {
+	// CA with the PEM encoded CA certificate.
+	CA []byte
+	// Certificate with the PEM encoded server certificate.
+	Certificate []byte
+	// Key with the PEM encoded private key of the server certificate.
+	Key []byte
+}
+
+// EncodedCA returns the base64 encoded CA, suitable for connection.Config.ClientCA.
+func (c *Certificates) EncodedCA() string {
+	return base64.StdEncoding.EncodeToString(c.CA)
+}
+
+// EncodedCertificate returns the base64 encoded server certificate, suitable for connection.ServerConfig.TLSCertificate.
+func (c *Certificates) EncodedCertificate() string {
+	return base64.StdEncoding.EncodeToString(c.Certificate)
+}
+
+// EncodedKey returns the base64 encoded server key, suitable for connection.ServerConfig.TLSKey.
+func (c *Certificates) EncodedKey() string {
+	return base64.StdEncoding.EncodeToString(c.Key)
+}
+
+// GenerateCertificates creates a self-signed CA and a server certificate valid for the given host names and IP
+// addresses.
+func GenerateCertificates(hosts ...string) (*Certificates, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot generate CA key")
+	}
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "connectiontest CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(CertificateValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot create CA certificate")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot generate server key")
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "connectiontest server"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(CertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot create server certificate")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot marshal server key")
+	}
+	return &Certificates{
+		CA:          pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:         pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
@@ -0,0 +1,118 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectiontest
+
+import (
+	"context"
+	"net"
+
+	"github.com/napptive/go-utils/pkg/connection"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// ServerAddress with the host name used by the connection configurations pointing to a test server.
+const ServerAddress = "bufnet"
+
+// ServerPort with the port used by the connection configurations pointing to a test server. The port is not used
+// as connections are established in memory.
+const ServerPort = 443
+
+// DefaultBufferSize with the default size in bytes of the in-memory connection buffer.
+const DefaultBufferSize = 1024 * 1024
+
+// Options to create a test server.
+type Options struct {
+	// TLS enables TLS with self-signed certificates generated on the fly.
+	TLS bool
+	// ServerConfig with the base server configuration. The listen address and TLS certificates are overwritten.
+	ServerConfig connection.ServerConfig
+	// ServerOptions with additional options of the gRPC server such as extra interceptors.
+	ServerOptions []grpc.ServerOption
+	// BufferSize with the size of the in-memory connection buffer. DefaultBufferSize if zero.
+	BufferSize int
+}
+
+// Server is a connection.Server listening on an in-memory connection. Services must be registered before calling
+// Start.
+type Server struct {
+	*connection.Server
+	// Config with a connection configuration pointing to the server. Connections must be established with the Dialer.
+	Config *connection.Config
+	// Certificates with the generated certificates if TLS is enabled.
+	Certificates *Certificates
+	// listener with the in-memory listener.
+	listener *bufconn.Listener
+}
+
+// NewServer creates a test server with the given options.
+func NewServer(options Options) (*Server, error) {
+	serverConfig := options.ServerConfig
+	serverConfig.ListenAddress = net.JoinHostPort(ServerAddress, "0")
+	cfg := &connection.Config{Name: serverConfig.Name, ServerAddress: ServerAddress, ServerPort: ServerPort}
+	var certificates *Certificates
+	if options.TLS {
+		generated, err := GenerateCertificates(ServerAddress, "localhost", "127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		certificates = generated
+		serverConfig.TLSCertificate = certificates.EncodedCertificate()
+		serverConfig.TLSKey = certificates.EncodedKey()
+		cfg.UseTLS = true
+		cfg.ClientCA = certificates.EncodedCA()
+	}
+	server, err := connection.NewServer(&serverConfig, options.ServerOptions...)
+	if err != nil {
+		return nil, err
+	}
+	bufferSize := options.BufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Server{
+		Server:       server,
+		Config:       cfg,
+		Certificates: certificates,
+		listener:     bufconn.Listen(bufferSize),
+	}, nil
+}
+
+// Start serves the requests in background.
+func (s *Server) Start() {
+	go func() {
+		_ = s.Server.Serve(s.listener)
+	}()
+}
+
+// Dialer returns the dial option that connects to the in-memory server.
+func (s *Server) Dialer() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return s.listener.DialContext(ctx)
+	})
+}
+
+// Dial establishes a connection with the server using the server Config.
+func (s *Server) Dial(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return connection.GetConnection(s.Config, append([]grpc.DialOption{s.Dialer()}, opts...)...)
+}
+
+// Close stops the server and the listener.
+func (s *Server) Close() {
+	s.Server.Stop()
+	_ = s.listener.Close()
+}
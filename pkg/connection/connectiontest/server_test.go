@@ -0,0 +1,103 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connectiontest
+
+import (
+	"context"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = ginkgo.Describe("Test server", func() {
+
+	var server *Server
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	check := func(conn *grpc.ClientConn) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	ginkgo.It("should serve plain connections", func() {
+		var err error
+		server, err = NewServer(Options{})
+		gomega.Expect(err).To(gomega.Succeed())
+		server.Start()
+		gomega.Expect(server.Config.IsValid()).To(gomega.Succeed())
+
+		conn, err := server.Dial()
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		gomega.Expect(check(conn)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should serve TLS connections verified with the generated CA", func() {
+		var err error
+		server, err = NewServer(Options{TLS: true})
+		gomega.Expect(err).To(gomega.Succeed())
+		server.Start()
+		gomega.Expect(server.Config.UseTLS).To(gomega.BeTrue())
+		gomega.Expect(server.Config.ClientCA).To(gomega.Equal(server.Certificates.EncodedCA()))
+
+		conn, err := server.Dial()
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		gomega.Expect(check(conn)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject TLS connections verified with another CA", func() {
+		var err error
+		server, err = NewServer(Options{TLS: true})
+		gomega.Expect(err).To(gomega.Succeed())
+		server.Start()
+		other, err := GenerateCertificates(ServerAddress)
+		gomega.Expect(err).To(gomega.Succeed())
+		server.Config.ClientCA = other.EncodedCA()
+
+		conn, err := server.Dial()
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		gomega.Expect(check(conn)).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should apply additional server interceptors", func() {
+		methods := make(chan string, 1)
+		var err error
+		server, err = NewServer(Options{ServerOptions: []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				methods <- info.FullMethod
+				return handler(ctx, req)
+			})}})
+		gomega.Expect(err).To(gomega.Succeed())
+		server.Start()
+
+		conn, err := server.Dial()
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		gomega.Expect(check(conn)).To(gomega.Succeed())
+		gomega.Expect(methods).To(gomega.Receive(gomega.Equal("/grpc.health.v1.Health/Check")))
+	})
+})
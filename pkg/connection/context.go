@@ -18,6 +18,8 @@ package connection
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/napptive/go-utils/pkg/printer"
@@ -39,6 +41,11 @@ type ContextHelper struct {
 	Version string
 	// Agent sending the request.
 	Agent string
+	// CancelOnSignal indicates that the contexts must be canceled when an interrupt signal is received.
+	CancelOnSignal bool
+	// OnCancel is called when a context is canceled due to an interrupt signal. If not set, the
+	// cancellation is reported on the standard error so that the command output is not altered.
+	OnCancel CancelHook
 
 	printer.ResultPrinter
 }
@@ -52,9 +59,51 @@ func NewContextHelper(version string, agent string, printer printer.ResultPrinte
 	}
 }
 
-// GetContext returns a valid gRPC context with the appropriate authorization header.
+// NewInterruptibleContextHelper creates a ContextHelper whose contexts are canceled when the user interrupts the process.
+func NewInterruptibleContextHelper(version string, agent string, printer printer.ResultPrinter) *ContextHelper {
+	helper := NewContextHelper(version, agent, printer)
+	helper.CancelOnSignal = true
+	return helper
+}
+
+// GetContext returns a valid gRPC context with the appropriate authorization header. If CancelOnSignal is set, the
+// context is also canceled when an interrupt signal is received.
 func (ch *ContextHelper) GetContext() (context.Context, context.CancelFunc) {
+	return ch.newContext(ContextTimeout)
+}
+
+// GetContextWithoutTimeout returns a context like GetContext without the ContextTimeout deadline, letting the
+// per method timeouts of the connection apply.
+func (ch *ContextHelper) GetContextWithoutTimeout() (context.Context, context.CancelFunc) {
+	return ch.newContext(0)
+}
+
+// newContext returns a context with the metadata headers and the given timeout, if any.
+func (ch *ContextHelper) newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
 	md := metadata.New(map[string]string{AgentHeader: ch.Agent, VersionHeader: ch.Version})
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
-	return context.WithTimeout(ctx, ContextTimeout)
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if !ch.CancelOnSignal {
+		return ctx, cancel
+	}
+	onCancel := ch.OnCancel
+	if onCancel == nil {
+		onCancel = printCancelled
+	}
+	signalCtx, signalCancel := NewSignalContext(ctx, onCancel)
+	return signalCtx, func() {
+		signalCancel()
+		cancel()
+	}
+}
+
+// printCancelled reports the cancellation of an operation on the standard error. The ResultPrinter is not used as
+// the signal is handled concurrently with the command, whose output could be corrupted.
+func printCancelled(sig os.Signal) {
+	fmt.Fprintf(os.Stderr, "operation cancelled by %s\n", sig)
 }
@@ -0,0 +1,379 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/napptive/go-utils/pkg/printer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// CertificateExpiryWarning with the remaining validity below which the diagnostics warn about the server certificate.
+const CertificateExpiryWarning = 30 * 24 * time.Hour
+
+// DiagnosticsReportTemplate with the table template used to print a DiagnosticsReport.
+const DiagnosticsReportTemplate = `TARGET	{{.Target}}
+
+CHECK	STATUS	DETAILS
+{{range .Checks}}{{.Name}}	{{.Status}}	{{.Details}}
+{{end}}{{if .Certificates}}
+SUBJECT	ISSUER	EXPIRES	PIN
+{{range .Certificates}}{{.Subject}}	{{.Issuer}}	{{.NotAfter.Format "2006-01-02"}}	{{.SPKIPin}}
+{{end}}{{end}}`
+
+// CheckStatus with the result of a diagnostic check.
+type CheckStatus string
+
+const (
+	// CheckOK indicates that the check succeeded.
+	CheckOK CheckStatus = "OK"
+	// CheckWarning indicates that the check succeeded with a potential problem.
+	CheckWarning CheckStatus = "WARNING"
+	// CheckFailed indicates that the check failed.
+	CheckFailed CheckStatus = "FAILED"
+	// CheckSkipped indicates that the check was not executed.
+	CheckSkipped CheckStatus = "SKIPPED"
+)
+
+// DiagnosticCheck with the result of a step of the connection diagnostics.
+type DiagnosticCheck struct {
+	// Name of the check.
+	Name string `json:"name"`
+	// Status with the result of the check.
+	Status CheckStatus `json:"status"`
+	// Details with a human-readable explanation of the result.
+	Details string `json:"details,omitempty"`
+}
+
+// CertificateInfo with the relevant information of a certificate presented by the server.
+type CertificateInfo struct {
+	// Subject of the certificate.
+	Subject string `json:"subject"`
+	// Issuer of the certificate.
+	Issuer string `json:"issuer"`
+	// NotBefore with the start of the validity period.
+	NotBefore time.Time `json:"notBefore"`
+	// NotAfter with the end of the validity period.
+	NotAfter time.Time `json:"notAfter"`
+	// DNSNames with the names the certificate is valid for.
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// SPKIPin with the pin of the certificate public key, as accepted by Config.CertificatePins.
+	SPKIPin string `json:"spkiPin"`
+}
+
+// DiagnosticsReport with the result of the connection diagnostics.
+type DiagnosticsReport struct {
+	// Target with the address diagnosed.
+	Target string `json:"target"`
+	// Checks with the result of each step.
+	Checks []DiagnosticCheck `json:"checks"`
+	// Certificates with the certificate chain presented by the server.
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+}
+
+// Healthy checks if none of the checks failed.
+func (dr *DiagnosticsReport) Healthy() bool {
+	for _, check := range dr.Checks {
+		if check.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// add appends the result of a check.
+func (dr *DiagnosticsReport) add(name string, status CheckStatus, format string, args ...interface{}) {
+	dr.Checks = append(dr.Checks, DiagnosticCheck{Name: name, Status: status, Details: fmt.Sprintf(format, args...)})
+}
+
+// skip marks a list of checks as skipped.
+func (dr *DiagnosticsReport) skip(reason string, names ...string) {
+	for _, name := range names {
+		dr.add(name, CheckSkipped, "%s", reason)
+	}
+}
+
+// PrintDiagnosticsReport prints a report with the given printer.
+func PrintDiagnosticsReport(resultPrinter printer.ResultPrinter, report *DiagnosticsReport) error {
+	return printResult(resultPrinter, report, DiagnosticsReportTemplate)
+}
+
+// Diagnose checks the connectivity with the server described by a configuration: it validates the configuration,
+// resolves the address, opens a connection, performs the TLS handshake verifying the certificate chain, and checks
+// the gRPC health and reflection services. The dial options are used to establish the gRPC connection.
+func Diagnose(ctx context.Context, cfg *Config, opts ...grpc.DialOption) *DiagnosticsReport {
+	report := &DiagnosticsReport{Target: cfg.GetEffectiveAddress()}
+	if err := cfg.IsValid(); err != nil {
+		report.add("configuration", CheckFailed, "%s", err.Error())
+		report.skip("invalid configuration", "dns", "connect", "tls", "health", "reflection")
+		return report
+	}
+	report.add("configuration", CheckOK, "")
+
+	timeout := cfg.ConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+	conn, reachable := diagnoseNetwork(ctx, cfg, report, timeout)
+	if conn != nil {
+		defer conn.Close()
+		if cfg.UseTLS {
+			diagnoseTLS(ctx, cfg, conn, report, timeout)
+		} else {
+			report.skip("TLS is not enabled", "tls")
+		}
+	}
+	if !reachable {
+		report.skip("server is not reachable", "health", "reflection")
+		return report
+	}
+	// Certificates are not recorded while diagnosing in trust on first use mode.
+	grpcConfig := *cfg
+	grpcConfig.PinRecorder = nil
+	diagnoseGRPC(ctx, &grpcConfig, report, timeout, opts)
+	return report
+}
+
+// diagnoseNetwork resolves the server address and opens a connection with it. It returns the connection, if it
+// could be established, and whether the gRPC checks can be executed.
+func diagnoseNetwork(ctx context.Context, cfg *Config, report *DiagnosticsReport, timeout time.Duration) (net.Conn, bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+
+	if path, isUnix := cfg.getUnixSocketPath(); isUnix {
+		report.add("dns", CheckSkipped, "unix socket")
+		conn, err := dialer.DialContext(ctx, unixScheme, path)
+		if err != nil {
+			report.add("connect", CheckFailed, "%s", err.Error())
+			return nil, false
+		}
+		report.add("connect", CheckOK, "connected to %s", path)
+		return conn, true
+	}
+	if scheme, _, isURI := parseTarget(cfg.ServerAddress); isURI && scheme != dnsScheme {
+		report.skip("address resolved by the "+scheme+" resolver", "dns", "connect", "tls")
+		return nil, true
+	}
+
+	address := cfg.GetHostPort()
+	host, _, _ := net.SplitHostPort(address)
+	var proxyURL *url.URL
+	if cfg.Proxy.Enabled() {
+		proxyURL, _ = cfg.Proxy.ProxyFor(&url.URL{Scheme: "https", Host: address})
+	}
+
+	if net.ParseIP(host) != nil {
+		report.add("dns", CheckOK, "%s is an IP address", host)
+	} else if addresses, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		if proxyURL == nil {
+			report.add("dns", CheckFailed, "%s", err.Error())
+			report.skip("address cannot be resolved", "connect", "tls")
+			return nil, false
+		}
+		report.add("dns", CheckWarning, "%s, the address may be resolved by the proxy", err.Error())
+	} else {
+		report.add("dns", CheckOK, "%s resolves to %s", host, strings.Join(addresses, ", "))
+	}
+
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if proxyURL != nil {
+		conn, err = dialThroughProxy(ctx, dialer, proxyURL, address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		report.add("connect", CheckFailed, "%s", err.Error())
+		report.skip("cannot connect", "tls")
+		return nil, false
+	}
+	details := fmt.Sprintf("connected to %s in %s", conn.RemoteAddr(), time.Since(start).Round(time.Millisecond))
+	if proxyURL != nil {
+		details = fmt.Sprintf("connected to %s through proxy %s in %s", address, proxyURL.Host, time.Since(start).Round(time.Millisecond))
+	}
+	report.add("connect", CheckOK, "%s", details)
+	return conn, true
+}
+
+// diagnoseTLS performs the TLS handshake over a connection, reporting the certificate chain presented by the
+// server and the result of its verification.
+func diagnoseTLS(ctx context.Context, cfg *Config, conn net.Conn, report *DiagnosticsReport, timeout time.Duration) {
+	tlsConfig, err := getTLSConfig(cfg)
+	if err != nil {
+		report.add("tls", CheckFailed, "%s", err.Error())
+		return
+	}
+	// The handshake accepts any certificate so that the chain can be reported, and it is verified afterwards.
+	handshakeConfig := tlsConfig.Clone()
+	handshakeConfig.InsecureSkipVerify = true
+	handshakeConfig.VerifyConnection = nil
+	handshakeConfig.NextProtos = []string{"h2"}
+	if handshakeConfig.ServerName == "" {
+		host, _, _ := net.SplitHostPort(cfg.GetHostPort())
+		handshakeConfig.ServerName = trimBrackets(host)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, handshakeConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		report.add("tls", CheckFailed, "handshake failed: %s", err.Error())
+		return
+	}
+	state := tlsConn.ConnectionState()
+	report.add("tls", CheckOK, "%s with %s", tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	for _, certificate := range state.PeerCertificates {
+		report.Certificates = append(report.Certificates, CertificateInfo{
+			Subject:   certificate.Subject.String(),
+			Issuer:    certificate.Issuer.String(),
+			NotBefore: certificate.NotBefore,
+			NotAfter:  certificate.NotAfter,
+			DNSNames:  certificate.DNSNames,
+			SPKIPin:   SPKIPin(certificate),
+		})
+	}
+	if len(state.PeerCertificates) == 0 {
+		report.add("certificate", CheckFailed, "server did not present any certificate")
+		return
+	}
+	diagnoseCertificate(cfg, tlsConfig, handshakeConfig.ServerName, state.PeerCertificates, report)
+}
+
+// diagnoseCertificate verifies the certificate chain presented by the server as the connection would do, and
+// checks the expiration of the server certificate.
+func diagnoseCertificate(cfg *Config, tlsConfig *tls.Config, serverName string, chain []*x509.Certificate, report *DiagnosticsReport) {
+	leaf := chain[0]
+	switch {
+	case cfg.SkipCertValidation:
+		report.add("certificate", CheckWarning, "certificate validation is disabled")
+	case len(cfg.CertificatePins) == 0 && cfg.TrustOnFirstUse:
+		report.add("certificate", CheckWarning, "no pins recorded yet, %s would be trusted on first use", SPKIPin(leaf))
+	case tlsConfig.VerifyConnection != nil:
+		if err := tlsConfig.VerifyConnection(tls.ConnectionState{PeerCertificates: chain, ServerName: serverName}); err != nil {
+			report.add("certificate", CheckFailed, "%s", err.Error())
+		} else {
+			report.add("certificate", CheckOK, "certificate matches the pinned certificates")
+		}
+	default:
+		intermediates := x509.NewCertPool()
+		for _, certificate := range chain[1:] {
+			intermediates.AddCert(certificate)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{Roots: tlsConfig.RootCAs, DNSName: serverName, Intermediates: intermediates})
+		if err != nil {
+			report.add("certificate", CheckFailed, "%s", err.Error())
+		} else {
+			report.add("certificate", CheckOK, "certificate is valid for %s", serverName)
+		}
+	}
+
+	remaining := time.Until(leaf.NotAfter)
+	switch {
+	case remaining <= 0:
+		report.add("expiration", CheckFailed, "certificate expired on %s", leaf.NotAfter.Format(time.RFC3339))
+	case remaining < CertificateExpiryWarning:
+		report.add("expiration", CheckWarning, "certificate expires on %s", leaf.NotAfter.Format(time.RFC3339))
+	default:
+		report.add("expiration", CheckOK, "certificate expires on %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// tlsVersionName returns the name of a TLS version.
+func tlsVersionName(version uint16) string {
+	for name, value := range tlsVersions {
+		if value == version {
+			return "TLS " + name
+		}
+	}
+	return fmt.Sprintf("TLS 0x%04x", version)
+}
+
+// diagnoseGRPC checks the health and reflection services of the server.
+func diagnoseGRPC(ctx context.Context, cfg *Config, report *DiagnosticsReport, timeout time.Duration, opts []grpc.DialOption) {
+	conn, err := GetConnection(cfg, opts...)
+	if err != nil {
+		report.add("health", CheckFailed, "%s", err.Error())
+		report.skip("cannot establish the gRPC connection", "reflection")
+		return
+	}
+	defer conn.Close()
+
+	healthCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(healthCtx, &grpc_health_v1.HealthCheckRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		report.add("health", CheckWarning, "health service is not available")
+	case err != nil:
+		report.add("health", CheckFailed, "%s", err.Error())
+	case response.Status != grpc_health_v1.HealthCheckResponse_SERVING:
+		report.add("health", CheckFailed, "server status is %s", response.Status)
+	default:
+		report.add("health", CheckOK, "server status is %s", response.Status)
+	}
+
+	services, err := listServices(ctx, conn, timeout)
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		report.add("reflection", CheckWarning, "reflection service is not available")
+	case err != nil:
+		report.add("reflection", CheckFailed, "%s", err.Error())
+	default:
+		report.add("reflection", CheckOK, "services: %s", strings.Join(services, ", "))
+	}
+}
+
+// listServices returns the services exposed by the server using the reflection service.
+func listServices(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stream, err := grpc_reflection_v1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+	if err := stream.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		return nil, err
+	}
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errorResponse := response.GetErrorResponse(); errorResponse != nil {
+		return nil, status.Error(codes.Code(errorResponse.ErrorCode), errorResponse.ErrorMessage)
+	}
+	services := make([]string, 0)
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.Name)
+	}
+	return services, nil
+}
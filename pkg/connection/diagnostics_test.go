@@ -0,0 +1,128 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection_test
+
+import (
+	"context"
+	"net"
+
+	"github.com/napptive/go-utils/pkg/connection"
+	"github.com/napptive/go-utils/pkg/connection/connectiontest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// checkStatuses returns the status of each check of a report.
+func checkStatuses(report *connection.DiagnosticsReport) map[string]connection.CheckStatus {
+	result := make(map[string]connection.CheckStatus)
+	for _, check := range report.Checks {
+		result[check.Name] = check.Status
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Connection diagnostics", func() {
+
+	var server *connection.Server
+	var certificates *connectiontest.Certificates
+	var port int
+
+	startServer := func(useTLS bool) {
+		serverConfig := &connection.ServerConfig{ListenAddress: "127.0.0.1:0"}
+		if useTLS {
+			var err error
+			certificates, err = connectiontest.GenerateCertificates("127.0.0.1")
+			gomega.Expect(err).To(gomega.Succeed())
+			serverConfig.TLSCertificate = certificates.EncodedCertificate()
+			serverConfig.TLSKey = certificates.EncodedKey()
+		}
+		var err error
+		server, err = connection.NewServer(serverConfig)
+		gomega.Expect(err).To(gomega.Succeed())
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		gomega.Expect(err).To(gomega.Succeed())
+		port = listener.Addr().(*net.TCPAddr).Port
+		go func(server *connection.Server) {
+			_ = server.Serve(listener)
+		}(server)
+	}
+
+	ginkgo.AfterEach(func() {
+		if server != nil {
+			server.Stop()
+			server = nil
+		}
+	})
+
+	ginkgo.It("should report a healthy plain connection", func() {
+		startServer(false)
+		report := connection.Diagnose(context.Background(), &connection.Config{ServerAddress: "127.0.0.1", ServerPort: port})
+		gomega.Expect(report.Healthy()).To(gomega.BeTrue())
+		gomega.Expect(checkStatuses(report)).To(gomega.Equal(map[string]connection.CheckStatus{
+			"configuration": connection.CheckOK,
+			"dns":           connection.CheckOK,
+			"connect":       connection.CheckOK,
+			"tls":           connection.CheckSkipped,
+			"health":        connection.CheckOK,
+			"reflection":    connection.CheckOK,
+		}))
+		gomega.Expect(report.Checks[len(report.Checks)-1].Details).To(gomega.ContainSubstring("grpc.health.v1.Health"))
+	})
+
+	ginkgo.It("should report the certificate chain of a trusted TLS connection", func() {
+		startServer(true)
+		cfg := &connection.Config{ServerAddress: "127.0.0.1", ServerPort: port, UseTLS: true, ClientCA: certificates.EncodedCA()}
+		report := connection.Diagnose(context.Background(), cfg)
+		gomega.Expect(report.Healthy()).To(gomega.BeTrue(), "%+v", report.Checks)
+		statuses := checkStatuses(report)
+		gomega.Expect(statuses["tls"]).To(gomega.Equal(connection.CheckOK))
+		gomega.Expect(statuses["certificate"]).To(gomega.Equal(connection.CheckOK))
+		gomega.Expect(statuses["expiration"]).To(gomega.Equal(connection.CheckWarning))
+		gomega.Expect(report.Certificates).To(gomega.HaveLen(1))
+		gomega.Expect(report.Certificates[0].Subject).To(gomega.ContainSubstring("connectiontest server"))
+	})
+
+	ginkgo.It("should report the verification errors of an untrusted certificate", func() {
+		startServer(true)
+		report := connection.Diagnose(context.Background(), &connection.Config{ServerAddress: "127.0.0.1", ServerPort: port, UseTLS: true})
+		gomega.Expect(report.Healthy()).To(gomega.BeFalse())
+		statuses := checkStatuses(report)
+		gomega.Expect(statuses["tls"]).To(gomega.Equal(connection.CheckOK))
+		gomega.Expect(statuses["certificate"]).To(gomega.Equal(connection.CheckFailed))
+		gomega.Expect(statuses["health"]).To(gomega.Equal(connection.CheckFailed))
+		gomega.Expect(report.Certificates).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should report unreachable servers", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		gomega.Expect(err).To(gomega.Succeed())
+		port = listener.Addr().(*net.TCPAddr).Port
+		gomega.Expect(listener.Close()).To(gomega.Succeed())
+
+		report := connection.Diagnose(context.Background(), &connection.Config{ServerAddress: "127.0.0.1", ServerPort: port})
+		gomega.Expect(report.Healthy()).To(gomega.BeFalse())
+		statuses := checkStatuses(report)
+		gomega.Expect(statuses["connect"]).To(gomega.Equal(connection.CheckFailed))
+		gomega.Expect(statuses["health"]).To(gomega.Equal(connection.CheckSkipped))
+	})
+
+	ginkgo.It("should report invalid configurations", func() {
+		report := connection.Diagnose(context.Background(), &connection.Config{})
+		gomega.Expect(report.Healthy()).To(gomega.BeFalse())
+		gomega.Expect(report.Checks[0].Status).To(gomega.Equal(connection.CheckFailed))
+	})
+})
@@ -0,0 +1,333 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/napptive/go-utils/pkg/printer"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MethodListTemplate with the table template used to print a MethodList.
+const MethodListTemplate = `METHOD	REQUEST	RESPONSE	STREAMING
+{{range .Methods}}{{.FullName}}	{{.RequestType}}	{{.ResponseType}}	{{.Streaming}}
+{{end}}`
+
+// InvocationResponseTemplate with the table template used to print an InvocationResponse.
+const InvocationResponseTemplate = `{{printf "%s" .Response}}
+`
+
+// maxDependencyRequests with the maximum number of reflection requests used to resolve the dependencies of a file.
+const maxDependencyRequests = 100
+
+// MethodInfo with the description of a method obtained through reflection.
+type MethodInfo struct {
+	// FullName of the method with the form /package.Service/Method.
+	FullName string `json:"fullName"`
+	// RequestType with the full name of the request message.
+	RequestType string `json:"requestType"`
+	// ResponseType with the full name of the response message.
+	ResponseType string `json:"responseType"`
+	// Streaming with the streaming mode of the method: none, client, server, or bidi.
+	Streaming string `json:"streaming"`
+}
+
+// MethodList with the methods of a service.
+type MethodList struct {
+	// Service with the full name of the service.
+	Service string `json:"service"`
+	// Methods of the service.
+	Methods []MethodInfo `json:"methods"`
+}
+
+// InvocationResponse with a response received from a dynamic invocation.
+type InvocationResponse struct {
+	// Method invoked.
+	Method string `json:"method"`
+	// Response with the JSON representation of the response message.
+	Response json.RawMessage `json:"response"`
+}
+
+// DynamicClient invokes the methods of a server without the generated stubs, obtaining the message descriptors
+// through the server reflection service.
+type DynamicClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewDynamicClient creates a DynamicClient over a connection obtained from GetConnection.
+func NewDynamicClient(conn *grpc.ClientConn) *DynamicClient {
+	return &DynamicClient{conn: conn}
+}
+
+// ListServices returns the full names of the services exposed by the server.
+func (dc *DynamicClient) ListServices(ctx context.Context) ([]string, error) {
+	services, err := listServices(ctx, dc.conn, DefaultConnectTimeout)
+	if err != nil {
+		return nil, reflectionError(err, "cannot list services")
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// ListMethods returns the methods of a service.
+func (dc *DynamicClient) ListMethods(ctx context.Context, service string) (*MethodList, error) {
+	descriptor, err := dc.resolveService(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	result := &MethodList{Service: service, Methods: make([]MethodInfo, 0)}
+	methods := descriptor.Methods()
+	for index := 0; index < methods.Len(); index++ {
+		result.Methods = append(result.Methods, newMethodInfo(methods.Get(index)))
+	}
+	return result, nil
+}
+
+// Invoke calls a unary or server-streaming method (e.g., package.Service/Method) with a request built from its
+// JSON representation. The onResponse function is called with each response received.
+func (dc *DynamicClient) Invoke(ctx context.Context, method string, requestJSON string, onResponse func(response *InvocationResponse) error) error {
+	descriptor, err := dc.resolveMethod(ctx, method)
+	if err != nil {
+		return err
+	}
+	fullName := methodFullName(descriptor)
+	if descriptor.IsStreamingClient() {
+		return nerrors.NewUnimplementedError("client streaming method %s cannot be invoked", fullName)
+	}
+	request := dynamicpb.NewMessage(descriptor.Input())
+	if strings.TrimSpace(requestJSON) == "" {
+		requestJSON = "{}"
+	}
+	if err := protojson.Unmarshal([]byte(requestJSON), request); err != nil {
+		return nerrors.NewInvalidArgumentErrorFrom(err, "invalid request for %s", fullName)
+	}
+
+	handle := func(response proto.Message) error {
+		content, err := protojson.MarshalOptions{Multiline: true}.Marshal(response)
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "cannot transform response of %s to JSON", fullName)
+		}
+		return onResponse(&InvocationResponse{Method: fullName, Response: content})
+	}
+
+	if !descriptor.IsStreamingServer() {
+		response := dynamicpb.NewMessage(descriptor.Output())
+		if err := dc.conn.Invoke(ctx, fullName, request, response); err != nil {
+			return err
+		}
+		return handle(response)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := dc.conn.NewStream(ctx, &grpc.StreamDesc{StreamName: string(descriptor.Name()), ServerStreams: true}, fullName)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		response := dynamicpb.NewMessage(descriptor.Output())
+		if err := stream.RecvMsg(response); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := handle(response); err != nil {
+			return err
+		}
+	}
+}
+
+// InvokeAndPrint calls a method as Invoke does, printing each response with the given printer.
+func (dc *DynamicClient) InvokeAndPrint(ctx context.Context, method string, requestJSON string, resultPrinter printer.ResultPrinter) error {
+	return dc.Invoke(ctx, method, requestJSON, func(response *InvocationResponse) error {
+		return printResult(resultPrinter, response, InvocationResponseTemplate)
+	})
+}
+
+// PrintMethods lists the methods of a service and prints them with the given printer.
+func (dc *DynamicClient) PrintMethods(ctx context.Context, service string, resultPrinter printer.ResultPrinter) error {
+	methods, err := dc.ListMethods(ctx, service)
+	if err != nil {
+		return err
+	}
+	return printResult(resultPrinter, methods, MethodListTemplate)
+}
+
+// resolveMethod returns the descriptor of a method with the form package.Service/Method or /package.Service/Method.
+func (dc *DynamicClient) resolveMethod(ctx context.Context, method string) (protoreflect.MethodDescriptor, error) {
+	service, name, err := splitMethodName(method)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, nerrors.NewInvalidArgumentError("invalid method name %q, expecting package.Service/Method", method)
+	}
+	descriptor, err := dc.resolveService(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	result := descriptor.Methods().ByName(protoreflect.Name(name))
+	if result == nil {
+		return nil, nerrors.NewNotFoundError("method %s not found in service %s", name, service)
+	}
+	return result, nil
+}
+
+// resolveService returns the descriptor of a service, requesting the file that defines it and all its
+// dependencies to the reflection service.
+func (dc *DynamicClient) resolveService(ctx context.Context, service string) (protoreflect.ServiceDescriptor, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := grpc_reflection_v1alpha.NewServerReflectionClient(dc.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, reflectionError(err, "cannot open reflection stream")
+	}
+	defer stream.CloseSend()
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	fetch := func(request *grpc_reflection_v1alpha.ServerReflectionRequest) error {
+		if err := stream.Send(request); err != nil {
+			return reflectionError(err, "cannot send reflection request")
+		}
+		response, err := stream.Recv()
+		if err != nil {
+			return reflectionError(err, "cannot receive reflection response")
+		}
+		if errorResponse := response.GetErrorResponse(); errorResponse != nil {
+			if codes.Code(errorResponse.ErrorCode) == codes.NotFound {
+				return nerrors.NewNotFoundError("%s", errorResponse.ErrorMessage)
+			}
+			return nerrors.NewInternalError("reflection error: %s", errorResponse.ErrorMessage)
+		}
+		for _, content := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(content, file); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "cannot decode file descriptor")
+			}
+			files[file.GetName()] = file
+		}
+		return nil
+	}
+
+	if err := fetch(&grpc_reflection_v1alpha.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}); err != nil {
+		return nil, err
+	}
+	for requests := 0; ; requests++ {
+		missing := missingDependency(files)
+		if missing == "" {
+			break
+		}
+		if requests == maxDependencyRequests {
+			return nil, nerrors.NewInternalError("too many dependencies resolving service %s", service)
+		}
+		if err := fetch(&grpc_reflection_v1alpha.ServerReflectionRequest{
+			MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileByFilename{FileByFilename: missing},
+		}); err != nil {
+			return nil, err
+		}
+		if _, exists := files[missing]; !exists {
+			return nil, nerrors.NewNotFoundError("dependency %s of service %s not found", missing, service)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		set.File = append(set.File, file)
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot build descriptors of service %s", service)
+	}
+	descriptor, err := registry.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nerrors.NewNotFoundErrorFrom(err, "service %s not found", service)
+	}
+	result, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nerrors.NewInvalidArgumentError("%s is not a service", service)
+	}
+	return result, nil
+}
+
+// missingDependency returns the name of a dependency not included in the files, or an empty string if all the
+// dependencies are available.
+func missingDependency(files map[string]*descriptorpb.FileDescriptorProto) string {
+	for _, file := range files {
+		for _, dependency := range file.GetDependency() {
+			if _, exists := files[dependency]; !exists {
+				return dependency
+			}
+		}
+	}
+	return ""
+}
+
+// reflectionError transforms an error received from the reflection service.
+func reflectionError(err error, message string) error {
+	extended := nerrors.FromGRPC(err)
+	if extended.Code == nerrors.Unimplemented {
+		return nerrors.NewUnimplementedErrorFrom(err, "server reflection is not available")
+	}
+	return nerrors.NewUnavailableErrorFrom(err, "%s", message)
+}
+
+// methodFullName returns the name of a method with the form /package.Service/Method.
+func methodFullName(method protoreflect.MethodDescriptor) string {
+	return "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+}
+
+// newMethodInfo returns the description of a method.
+func newMethodInfo(method protoreflect.MethodDescriptor) MethodInfo {
+	streaming := "none"
+	switch {
+	case method.IsStreamingClient() && method.IsStreamingServer():
+		streaming = "bidi"
+	case method.IsStreamingClient():
+		streaming = "client"
+	case method.IsStreamingServer():
+		streaming = "server"
+	}
+	return MethodInfo{
+		FullName:     methodFullName(method),
+		RequestType:  string(method.Input().FullName()),
+		ResponseType: string(method.Output().FullName()),
+		Streaming:    streaming,
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = ginkgo.Describe("Dynamic invocation", func() {
+
+	var server *Server
+	var conn *grpc.ClientConn
+	var client *DynamicClient
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	start := func(cfg *ServerConfig) {
+		var err error
+		server, err = NewServer(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		listener := bufconn.Listen(1024 * 1024)
+		go func(server *Server, listener *bufconn.Listener) {
+			_ = server.Serve(listener)
+		}(server, listener)
+		conn, err = GetConnection(&Config{ServerAddress: "bufnet", ServerPort: 443},
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}))
+		gomega.Expect(err).To(gomega.Succeed())
+		client = NewDynamicClient(conn)
+	}
+
+	ginkgo.BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	})
+
+	ginkgo.AfterEach(func() {
+		cancel()
+		gomega.Expect(conn.Close()).To(gomega.Succeed())
+		server.Stop()
+	})
+
+	ginkgo.Context("with reflection", func() {
+
+		ginkgo.BeforeEach(func() {
+			start(&ServerConfig{ListenAddress: "bufnet:0"})
+		})
+
+		ginkgo.It("should list services and methods", func() {
+			services, err := client.ListServices(ctx)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(services).To(gomega.ContainElement("grpc.health.v1.Health"))
+
+			methods, err := client.ListMethods(ctx, "grpc.health.v1.Health")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(methods.Methods).To(gomega.ConsistOf(
+				MethodInfo{FullName: "/grpc.health.v1.Health/Check", RequestType: "grpc.health.v1.HealthCheckRequest", ResponseType: "grpc.health.v1.HealthCheckResponse", Streaming: "none"},
+				MethodInfo{FullName: "/grpc.health.v1.Health/Watch", RequestType: "grpc.health.v1.HealthCheckRequest", ResponseType: "grpc.health.v1.HealthCheckResponse", Streaming: "server"},
+			))
+		})
+
+		ginkgo.It("should invoke unary methods and print the responses", func() {
+			resultPrinter := &recordingPrinter{}
+			gomega.Expect(client.InvokeAndPrint(ctx, "grpc.health.v1.Health/Check", `{"service": ""}`, resultPrinter)).To(gomega.Succeed())
+			printed := resultPrinter.Printed()
+			gomega.Expect(printed).To(gomega.HaveLen(1))
+			response, ok := printed[0].(*InvocationResponse)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(response.Method).To(gomega.Equal("/grpc.health.v1.Health/Check"))
+			gomega.Expect(string(response.Response)).To(gomega.ContainSubstring(`"SERVING"`))
+		})
+
+		ginkgo.It("should invoke server streaming methods", func() {
+			stop := errors.New("stop")
+			responses := 0
+			err := client.Invoke(ctx, "/grpc.health.v1.Health/Watch", "", func(response *InvocationResponse) error {
+				responses++
+				return stop
+			})
+			gomega.Expect(err).To(gomega.Equal(stop))
+			gomega.Expect(responses).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should report unknown methods and invalid requests", func() {
+			err := client.Invoke(ctx, "grpc.health.v1.Health/Missing", "", nil)
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.NotFound))
+			err = client.Invoke(ctx, "unknown.Service/Method", "", nil)
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.NotFound))
+			err = client.Invoke(ctx, "grpc.health.v1.Health/Check", `{"unknown": 1}`, nil)
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.InvalidArgument))
+		})
+	})
+
+	ginkgo.It("should report servers without reflection", func() {
+		start(&ServerConfig{ListenAddress: "bufnet:0", DisableReflection: true})
+		_, err := client.ListServices(ctx)
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.Unimplemented))
+	})
+})
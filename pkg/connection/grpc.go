@@ -17,48 +17,182 @@
 package connection
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
+	"context"
+	"encoding/json"
 
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 )
 
-// GetConnection creates a connection with a gRPC server.
-func GetConnection(cfg *Config) (*grpc.ClientConn, error) {
+// GetConnection creates a connection with a gRPC server. Additional dial options may be passed to customize the connection.
+func GetConnection(cfg *Config, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	if cfg.UseTLS {
-		return GetTLSConnection(cfg, cfg.GetEffectiveAddress())
+		return GetTLSConnection(cfg, cfg.GetEffectiveAddress(), opts...)
 	}
-	return GetNonTLSConnection(cfg, cfg.GetEffectiveAddress())
+	return GetNonTLSConnection(cfg, cfg.GetEffectiveAddress(), opts...)
 }
 
-// GetTLSConnection returns a TLS wrapped connection with the playground server.
-func GetTLSConnection(cfg *Config, address string) (*grpc.ClientConn, error) {
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: cfg.SkipCertValidation,
+// jsonServiceConfig is the JSON representation of a gRPC service config.
+type jsonServiceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	MethodConfig        []jsonMethodConfig    `json:"methodConfig,omitempty"`
+}
+
+// GetServiceConfig returns the JSON gRPC service config that applies the load balancing and retry options.
+func (cc *Config) GetServiceConfig() (string, error) {
+	// Hedged methods cannot be retried by the channel.
+	methodConfigs, err := cc.Retry.methodConfigs(cc.Hedging.Methods)
+	if err != nil {
+		return "", err
 	}
-	if cfg.ClientCA != "" {
-		cp := x509.NewCertPool()
-		decoded, err := base64.StdEncoding.DecodeString(cfg.ClientCA)
+	serviceConfig := jsonServiceConfig{MethodConfig: methodConfigs}
+	if cc.LoadBalancingPolicy != "" {
+		serviceConfig.LoadBalancingConfig = []map[string]struct{}{{cc.LoadBalancingPolicy: {}}}
+	}
+	result, err := json.Marshal(serviceConfig)
+	if err != nil {
+		return "", nerrors.NewInternalErrorFrom(err, "cannot build service config")
+	}
+	return string(result), nil
+}
+
+// getDialOptions returns the dial options derived from the configuration followed by the ones passed by the caller.
+func getDialOptions(cfg *Config, opts []grpc.DialOption) ([]grpc.DialOption, error) {
+	result := make([]grpc.DialOption, 0)
+	if cfg == nil {
+		return append(result, opts...), nil
+	}
+	if cfg.Retry.Enabled() || cfg.LoadBalancingPolicy != "" {
+		serviceConfig, err := cfg.GetServiceConfig()
 		if err != nil {
-			return nil, nerrors.NewInternalErrorFrom(err, "error decoding CA")
+			return nil, err
 		}
-		if !cp.AppendCertsFromPEM(decoded) {
-			return nil, nerrors.NewInternalError("Error appending CA")
+		result = append(result, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+	if cfg.Timeouts.Enabled() {
+		// Timeouts are applied first so that the deadline covers the retries and hedged requests.
+		result = append(result, WithUnaryInterceptors(TimeoutUnaryClientInterceptor(cfg.Timeouts)), WithStreamInterceptors(TimeoutStreamClientInterceptor(cfg.Timeouts)))
+	}
+	if cfg.CircuitBreaker.Enabled() {
+		// The breaker is placed before the hedging, retry and rate limit interceptors so that open circuits fail fast.
+		breaker, err := NewCircuitBreaker(cfg.CircuitBreaker)
+		if err != nil {
+			return nil, err
 		}
-		// add the CA as valid one
-		tlsConfig.RootCAs = cp
+		result = append(result, breaker.DialOptions()...)
+	}
+	if cfg.Hedging.Enabled() {
+		result = append(result, grpc.WithChainUnaryInterceptor(HedgingUnaryClientInterceptor(cfg.Hedging)))
+	}
+	if len(cfg.Retry.IdempotentMethods) > 0 {
+		result = append(result, grpc.WithChainUnaryInterceptor(RetryUnaryClientInterceptor(cfg.Retry)))
+	}
+	if cfg.RateLimit.Enabled() {
+		// Each retry attempt is limited as the limiter is placed after the retry interceptor.
+		rateLimiter := newRateLimiter(cfg.RateLimit)
+		result = append(result, WithUnaryInterceptors(rateLimiter.unaryInterceptor()), WithStreamInterceptors(rateLimiter.streamInterceptor()))
+	}
+	if _, isUnix := cfg.getUnixSocketPath(); cfg.Proxy.Enabled() && !isUnix {
+		result = append(result, cfg.Proxy.proxyDialOption())
+	}
+	return append(append(result, getTransportDialOptions(cfg)...), opts...), nil
+}
+
+// getTransportDialOptions returns the dial options related to keepalive, message sizes, compression, and flow control.
+func getTransportDialOptions(cfg *Config) []grpc.DialOption {
+	result := make([]grpc.DialOption, 0)
+	if cfg.KeepaliveTime > 0 {
+		result = append(result, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}))
+	}
+	callOptions := make([]grpc.CallOption, 0)
+	if cfg.MaxSendMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.Compression != "" {
+		callOptions = append(callOptions, grpc.UseCompressor(cfg.Compression))
+	}
+	if len(callOptions) > 0 {
+		result = append(result, grpc.WithDefaultCallOptions(callOptions...))
+	}
+	if cfg.InitialWindowSize > 0 {
+		result = append(result, grpc.WithInitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		result = append(result, grpc.WithInitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	return result
+}
+
+// GetTLSConnection returns a TLS wrapped connection with the playground server.
+func GetTLSConnection(cfg *Config, address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	tlsConfig, err := getTLSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 	tlsCredentials := credentials.NewTLS(tlsConfig)
-	return grpc.Dial(address, grpc.WithTransportCredentials(tlsCredentials))
+	return dial(cfg, address, grpc.WithTransportCredentials(tlsCredentials), opts)
 }
 
 // GetNonTLSConnection returns a plain connection with the playground server.
-func GetNonTLSConnection(_ *Config, address string) (*grpc.ClientConn, error) {
+func GetNonTLSConnection(cfg *Config, address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	log.Warn().Str("address", address).Msg("using insecure connection")
-	return grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	return dial(cfg, address, grpc.WithTransportCredentials(insecure.NewCredentials()), opts)
+}
+
+// dial creates the connection with the given credentials. If a blocking dial is requested, the call waits until the
+// connection is established or the connect timeout expires.
+func dial(cfg *Config, address string, credentialsOption grpc.DialOption, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOptions, err := getDialOptions(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	dialOptions = append([]grpc.DialOption{credentialsOption}, dialOptions...)
+	if cfg == nil || !cfg.BlockingDial {
+		return grpc.Dial(address, dialOptions...)
+	}
+	timeout := cfg.ConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, address, append(dialOptions, grpc.WithBlock(), grpc.WithReturnConnectionError())...)
+	if err != nil {
+		return nil, nerrors.NewUnavailableErrorFrom(err, "cannot connect to %s", address)
+	}
+	return conn, nil
+}
+
+// WaitForReady waits until the connection is ready and the standard health service reports the given service as
+// serving. Use an empty service name to check the overall health of the server.
+func WaitForReady(ctx context.Context, conn *grpc.ClientConn, service string) error {
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return nerrors.NewUnavailableError("server at %s is not ready, connection is %s", conn.Target(), state)
+		}
+	}
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+	if err != nil {
+		return nerrors.NewUnavailableErrorFrom(err, "cannot check the health of service %q at %s", service, conn.Target())
+	}
+	if response.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return nerrors.NewUnavailableError("service %q at %s is %s", service, conn.Target(), response.Status)
+	}
+	return nil
 }
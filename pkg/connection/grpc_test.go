@@ -0,0 +1,100 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = ginkgo.Describe("gRPC connections", func() {
+
+	ginkgo.Context("with a reachable server", func() {
+
+		var healthServer *health.Server
+		var server *grpc.Server
+		var dialer grpc.DialOption
+
+		ginkgo.BeforeEach(func() {
+			healthServer = health.NewServer()
+			healthServer.SetServingStatus("ready", grpc_health_v1.HealthCheckResponse_SERVING)
+			healthServer.SetServingStatus("starting", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+			server, dialer = startBufconnServer(healthServer)
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Stop()
+		})
+
+		ginkgo.It("should wait for the connection on blocking dials", func() {
+			conn, err := GetNonTLSConnection(&Config{BlockingDial: true, ConnectTimeout: time.Second}, "bufnet", dialer)
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			gomega.Expect(WaitForReady(ctx, conn, "ready")).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should report services that are not serving", func() {
+			conn, err := GetNonTLSConnection(&Config{}, "bufnet", dialer)
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err = WaitForReady(ctx, conn, "starting")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.Unavailable))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("bufnet"))
+		})
+
+	})
+
+	ginkgo.Context("with an unreachable server", func() {
+
+		dialer := grpc.WithContextDialer(func(_ context.Context, address string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: net.UnknownNetworkError("unreachable")}
+		})
+
+		ginkgo.It("should fail on blocking dials", func() {
+			_, err := GetNonTLSConnection(&Config{BlockingDial: true, ConnectTimeout: 200 * time.Millisecond}, "unreachable:7060", dialer)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.Unavailable))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("unreachable:7060"))
+		})
+
+		ginkgo.It("should fail waiting for the connection", func() {
+			conn, err := GetNonTLSConnection(&Config{}, "unreachable:7060", dialer)
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err = WaitForReady(ctx, conn, "")
+			gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.Unavailable))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("unreachable:7060"))
+		})
+
+	})
+
+})
@@ -0,0 +1,269 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultHedgingDelay with the default time to wait for a response before sending a hedged request.
+const DefaultHedgingDelay = 100 * time.Millisecond
+
+// DefaultHedgingAttempts with the default number of requests sent for a hedged call, including the original one.
+const DefaultHedgingAttempts = 2
+
+// DefaultNonFatalCodes with the default status codes that let the pending hedged requests continue.
+var DefaultNonFatalCodes = []string{"UNAVAILABLE"}
+
+// HedgingConfig contains the hedging options of a connection. Hedging sends additional copies of a request if the
+// response takes longer than a delay, and returns the first successful response, reducing the tail latency. It
+// must only be used for idempotent read methods.
+type HedgingConfig struct {
+	// Methods contains the hedged methods. Values are either a service (e.g., package.Service) or a method
+	// (e.g., package.Service/Method).
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// MaxAttempts with the maximum number of requests sent for a call. DefaultHedgingAttempts if zero.
+	MaxAttempts int `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	// Delay with the time to wait for a response before sending the next request. DefaultHedgingDelay if zero.
+	Delay time.Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// NonFatalCodes contains the gRPC status codes (e.g., UNAVAILABLE) that do not end the call while other
+	// requests are pending or can still be sent. DefaultNonFatalCodes if empty.
+	NonFatalCodes []string `json:"nonFatalCodes,omitempty" yaml:"nonFatalCodes,omitempty"`
+}
+
+// Enabled returns true if any method is hedged.
+func (hc HedgingConfig) Enabled() bool {
+	return len(hc.Methods) > 0
+}
+
+// IsValid checks if the hedging options are valid.
+func (hc HedgingConfig) IsValid() error {
+	for _, name := range hc.Methods {
+		if _, _, err := splitMethodName(name); err != nil {
+			return err
+		}
+	}
+	if hc.MaxAttempts < 0 || hc.MaxAttempts > MaxRetryAttempts {
+		return nerrors.NewInvalidArgumentError("hedging maxAttempts must be between 0 and %d", MaxRetryAttempts)
+	}
+	if hc.Delay < 0 {
+		return nerrors.NewInvalidArgumentError("hedging delay cannot be negative")
+	}
+	if _, err := parseCodes(hc.NonFatalCodes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkRetryOverlap checks that the hedged methods are not retried as well, as each hedged request would be retried
+// multiplying the load on the server. Methods are still hedged when a default retry policy is set, as the service
+// config disables the retries of the hedged methods.
+func (hc HedgingConfig) checkRetryOverlap(rc RetryConfig) error {
+	retried := append([]string{}, rc.IdempotentMethods...)
+	for name, policy := range rc.Methods {
+		if policy.withDefaults(rc.RetryPolicy).Enabled() {
+			retried = append(retried, name)
+		}
+	}
+	for _, hedged := range hc.Methods {
+		for _, name := range retried {
+			if methodsOverlap(hedged, name) {
+				return nerrors.NewInvalidArgumentError("%s cannot be hedged as %s is retried", hedged, name)
+			}
+		}
+	}
+	return nil
+}
+
+// methodsOverlap checks if two names with the form package.Service/Method or package.Service select a common method.
+func methodsOverlap(first string, second string) bool {
+	firstService, firstMethod, err := splitMethodName(first)
+	if err != nil {
+		return false
+	}
+	secondService, secondMethod, err := splitMethodName(second)
+	if err != nil || firstService != secondService {
+		return false
+	}
+	return firstMethod == "" || secondMethod == "" || firstMethod == secondMethod
+}
+
+// isHedged checks if a method is hedged.
+func (hc HedgingConfig) isHedged(method string) bool {
+	service, name, err := splitMethodName(method)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range hc.Methods {
+		candidateService, candidateName, err := splitMethodName(candidate)
+		if err != nil || candidateService != service {
+			continue
+		}
+		if candidateName == "" || candidateName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hedgingAttempt with the result of a request.
+type hedgingAttempt struct {
+	reply   proto.Message
+	err     error
+	header  metadata.MD
+	trailer metadata.MD
+	peer    peer.Peer
+}
+
+// hedgingResults contains the call options that collect the results of a call. As the requests of a hedged call run
+// concurrently, each request collects its own results and those of the returned request are copied to the caller.
+type hedgingResults struct {
+	headers  []*metadata.MD
+	trailers []*metadata.MD
+	peers    []*peer.Peer
+}
+
+// splitResultOptions extracts the header, trailer and peer call options from a list of call options.
+func splitResultOptions(opts []grpc.CallOption) ([]grpc.CallOption, hedgingResults) {
+	remaining := make([]grpc.CallOption, 0, len(opts))
+	var results hedgingResults
+	for _, opt := range opts {
+		switch option := opt.(type) {
+		case grpc.HeaderCallOption:
+			results.headers = append(results.headers, option.HeaderAddr)
+		case grpc.TrailerCallOption:
+			results.trailers = append(results.trailers, option.TrailerAddr)
+		case grpc.PeerCallOption:
+			results.peers = append(results.peers, option.PeerAddr)
+		default:
+			remaining = append(remaining, opt)
+		}
+	}
+	return remaining, results
+}
+
+// copyTo copies the results of a request to the call options of the caller.
+func (hr hedgingResults) copyTo(attempt hedgingAttempt) {
+	for _, header := range hr.headers {
+		*header = attempt.header
+	}
+	for _, trailer := range hr.trailers {
+		*trailer = attempt.trailer
+	}
+	for _, p := range hr.peers {
+		*p = attempt.peer
+	}
+}
+
+// HedgingUnaryClientInterceptor returns a client interceptor that hedges the configured methods.
+func HedgingUnaryClientInterceptor(config HedgingConfig) grpc.UnaryClientInterceptor {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultHedgingAttempts
+	}
+	delay := config.Delay
+	if delay == 0 {
+		delay = DefaultHedgingDelay
+	}
+	codeNames := config.NonFatalCodes
+	if len(codeNames) == 0 {
+		codeNames = DefaultNonFatalCodes
+	}
+	nonFatalCodes, err := parseCodes(codeNames)
+	if err != nil {
+		log.Warn().Err(err).Msg("invalid hedging non fatal codes, using the defaults")
+		nonFatalCodes = map[codes.Code]bool{codes.Unavailable: true}
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		target, isMessage := reply.(proto.Message)
+		if !isMessage || maxAttempts < 2 || !config.isHedged(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		// Pending requests are canceled once the call returns.
+		defer cancel()
+
+		callOpts, callResults := splitResultOptions(opts)
+		results := make(chan hedgingAttempt, maxAttempts)
+		send := func() {
+			attemptReply := proto.Clone(target)
+			proto.Reset(attemptReply)
+			go func() {
+				attempt := hedgingAttempt{reply: attemptReply}
+				attemptOpts := append(append(make([]grpc.CallOption, 0, len(callOpts)+3), callOpts...),
+					grpc.Header(&attempt.header), grpc.Trailer(&attempt.trailer), grpc.Peer(&attempt.peer))
+				attempt.err = invoker(ctx, method, req, attemptReply, cc, attemptOpts...)
+				results <- attempt
+			}()
+		}
+
+		send()
+		sent, pending := 1, 1
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		resetTimer := func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(delay)
+		}
+		for {
+			select {
+			case <-timer.C:
+				if sent < maxAttempts {
+					log.Debug().Str("method", method).Int("attempt", sent+1).Msg("sending hedged request")
+					send()
+					sent++
+					pending++
+					timer.Reset(delay)
+				}
+			case result := <-results:
+				pending--
+				if result.err == nil {
+					proto.Reset(target)
+					proto.Merge(target, result.reply)
+					callResults.copyTo(result)
+					return nil
+				}
+				if !nonFatalCodes[status.Code(result.err)] || (sent == maxAttempts && pending == 0) {
+					callResults.copyTo(result)
+					return result.err
+				}
+				if sent < maxAttempts {
+					send()
+					sent++
+					pending++
+					resetTimer()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("Request hedging", func() {
+
+	var healthServer *slowHealthServer
+	var server *grpc.Server
+	var dialer grpc.DialOption
+	var callTimeout time.Duration
+
+	ginkgo.BeforeEach(func() {
+		callTimeout = 5 * time.Second
+		healthServer = &slowHealthServer{slowCalls: 1}
+		server, dialer = startBufconnServer(healthServer)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Stop()
+	})
+
+	check := func(cfg *Config, opts ...grpc.CallOption) (*grpc_health_v1.HealthCheckResponse, error) {
+		conn, err := GetNonTLSConnection(cfg, "bufnet", dialer)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		defer cancel()
+		return grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, opts...)
+	}
+
+	ginkgo.It("should return the first successful response", func() {
+		cfg := &Config{Hedging: HedgingConfig{Methods: []string{"grpc.health.v1.Health"}, Delay: 10 * time.Millisecond}}
+		response, err := check(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(response.Status).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should return the header, trailer and peer of the returned request", func() {
+		cfg := &Config{Hedging: HedgingConfig{Methods: []string{"grpc.health.v1.Health"}, Delay: 10 * time.Millisecond}}
+		var header, trailer metadata.MD
+		var p peer.Peer
+		_, err := check(cfg, grpc.Header(&header), grpc.Trailer(&trailer), grpc.Peer(&p))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(p.Addr).ToNot(gomega.BeNil())
+		gomega.Expect(header).ToNot(gomega.BeNil())
+		// Let the canceled request finish so that the race detector sees any late write.
+		gomega.Eventually(healthServer.Calls).Should(gomega.Equal(2))
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	ginkgo.It("should wait for the pending requests after the last attempt", func() {
+		healthServer.slowCalls = 2
+		callTimeout = 200 * time.Millisecond
+		cfg := &Config{Hedging: HedgingConfig{Methods: []string{"grpc.health.v1.Health/Check"}, Delay: 10 * time.Millisecond}}
+		_, err := check(cfg)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.DeadlineExceeded))
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should hedge methods written with a leading slash", func() {
+		cfg := &Config{
+			Retry:   RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+			Hedging: HedgingConfig{Methods: []string{"/grpc.health.v1.Health/Check"}, Delay: 10 * time.Millisecond},
+		}
+		gomega.Expect(cfg.Hedging.IsValid()).To(gomega.Succeed())
+		gomega.Expect(cfg.Hedging.isHedged("/grpc.health.v1.Health/Check")).To(gomega.BeTrue())
+		_, err := check(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should not hedge other methods", func() {
+		healthServer.slowCalls = 0
+		cfg := &Config{Hedging: HedgingConfig{Methods: []string{"pkg.Service"}, Delay: time.Millisecond}}
+		_, err := check(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should reject hedged methods that are retried", func() {
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7000, Hedging: HedgingConfig{Methods: []string{"grpc.health.v1.Health"}}}
+		cfg.Retry.IdempotentMethods = []string{"grpc.health.v1.Health/Check"}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Retry.IdempotentMethods = nil
+		cfg.Retry.Methods = map[string]RetryPolicy{"grpc.health.v1.Health/Check": {MaxAttempts: 3}}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Retry.Methods = map[string]RetryPolicy{"pkg.Service": {MaxAttempts: 3}}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should disable the default retry policy on hedged methods", func() {
+		cfg := &Config{
+			Retry:   RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+			Hedging: HedgingConfig{Methods: []string{"grpc.health.v1.Health/Check"}, Delay: 10 * time.Millisecond},
+		}
+		gomega.Expect(cfg.GetServiceConfig()).To(gomega.ContainSubstring(`{"name":[{"service":"grpc.health.v1.Health","method":"Check"}]}`))
+		_, err := check(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should reject invalid hedging options", func() {
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7000}
+		cfg.Hedging = HedgingConfig{Methods: []string{"pkg.Service"}, MaxAttempts: 10}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Hedging.MaxAttempts = 3
+		cfg.Hedging.NonFatalCodes = []string{"NOT_A_CODE"}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Hedging.NonFatalCodes = []string{"UNAVAILABLE"}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+	})
+
+})
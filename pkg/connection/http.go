@@ -0,0 +1,300 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+)
+
+// AuthorizationHeader with the name of the header that contains the authentication token.
+const AuthorizationHeader = "Authorization"
+
+// maxErrorBodySize with the maximum number of bytes of an error response included in the returned error.
+const maxErrorBodySize = 1024
+
+// idempotentHTTPMethods contains the HTTP methods whose requests can be safely retried.
+var idempotentHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// httpStatusCodes maps HTTP status codes to their closest error code.
+var httpStatusCodes = map[int]nerrors.ErrorCode{
+	http.StatusBadRequest:            nerrors.InvalidArgument,
+	http.StatusUnauthorized:          nerrors.Unauthenticated,
+	http.StatusForbidden:             nerrors.PermissionDenied,
+	http.StatusNotFound:              nerrors.NotFound,
+	http.StatusMethodNotAllowed:      nerrors.Unimplemented,
+	http.StatusRequestTimeout:        nerrors.DeadlineExceeded,
+	http.StatusConflict:              nerrors.AlreadyExists,
+	http.StatusPreconditionFailed:    nerrors.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: nerrors.OutOfRange,
+	http.StatusUnprocessableEntity:   nerrors.InvalidArgument,
+	http.StatusTooManyRequests:       nerrors.ResourceExhausted,
+	499:                              nerrors.Canceled,
+	http.StatusNotImplemented:        nerrors.Unimplemented,
+	http.StatusBadGateway:            nerrors.Unavailable,
+	http.StatusServiceUnavailable:    nerrors.Unavailable,
+	http.StatusGatewayTimeout:        nerrors.DeadlineExceeded,
+}
+
+// HTTPOptions contains the request related options of an HTTPClient.
+type HTTPOptions struct {
+	// Agent sending the requests.
+	Agent string
+	// Version of the application sending the requests.
+	Version string
+	// Token sent as bearer token on the Authorization header. Required if authentication is enabled.
+	Token string
+	// AllowInsecureToken allows sending the Token on connections without TLS, where it can be intercepted. Intended
+	// for local development only.
+	AllowInsecureToken bool
+	// Timeout with the maximum duration of a request including retries. No timeout if zero.
+	Timeout time.Duration
+}
+
+// HTTPClient is a client of HTTP endpoints configured from the same Config used for gRPC connections.
+type HTTPClient struct {
+	// BaseURL with the scheme, host, and port of the server.
+	BaseURL string
+	// Client with the underlying HTTP client.
+	Client *http.Client
+}
+
+// NewHTTPClient creates an HTTPClient that applies the TLS, timeout, and retry options of the configuration. The token
+// is only sent on TLS connections unless AllowInsecureToken is set.
+func NewHTTPClient(cfg *Config, options HTTPOptions) (*HTTPClient, error) {
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+	if cfg.AuthEnable && options.Token == "" {
+		return nil, nerrors.NewInvalidArgumentError("authentication is enabled but no token was provided")
+	}
+	if options.Token != "" && !cfg.UseTLS && !options.AllowInsecureToken {
+		return nil, nerrors.NewFailedPreconditionError("cannot send the token on a connection without TLS")
+	}
+	transport, err := newHTTPTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if cfg.UseTLS {
+		scheme = "https"
+	}
+	host := cfg.GetHostPort()
+	if _, isUnix := cfg.getUnixSocketPath(); isUnix {
+		host = unixScheme
+	}
+	return &HTTPClient{
+		BaseURL: scheme + "://" + host,
+		Client: &http.Client{
+			Transport: &clientTransport{
+				base:    transport,
+				options: options,
+				retry:   cfg.Retry.RetryPolicy.withDefaults(RetryPolicy{}),
+			},
+			Timeout: options.Timeout,
+		},
+	}, nil
+}
+
+// newHTTPTransport creates the base transport of the client.
+func newHTTPTransport(cfg *Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.UseTLS {
+		tlsConfig, err := getTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: cfg.KeepaliveTime}
+	if path, isUnix := cfg.getUnixSocketPath(); isUnix {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, unixScheme, path)
+		}
+	} else {
+		transport.DialContext = dialer.DialContext
+		// Without a configured proxy, the proxy environment variables are honored as in the default transport.
+		if cfg.Proxy.Enabled() {
+			transport.Proxy = func(req *http.Request) (*url.URL, error) {
+				return cfg.Proxy.ProxyFor(req.URL)
+			}
+		}
+	}
+	return transport, nil
+}
+
+// clientTransport adds the agent, version, and authorization headers to the requests, retrying the idempotent
+// ones whose failure matches the retry policy.
+type clientTransport struct {
+	base    http.RoundTripper
+	options HTTPOptions
+	retry   RetryPolicy
+}
+
+// RoundTrip sends the request and retries it if needed.
+func (ct *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if ct.options.Agent != "" {
+		req.Header.Set(AgentHeader, ct.options.Agent)
+	}
+	if ct.options.Version != "" {
+		req.Header.Set(VersionHeader, ct.options.Version)
+	}
+	if ct.options.Token != "" {
+		req.Header.Set(AuthorizationHeader, "Bearer "+ct.options.Token)
+	}
+	retryable := ct.retry.Enabled() && idempotentHTTPMethods[req.Method] && (req.Body == nil || req.GetBody != nil)
+	retryableCodes, err := parseCodes(ct.retry.RetryableCodes)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := ct.base.RoundTrip(req)
+		if !retryable || attempt >= ct.retry.MaxAttempts || !retryableCodes[httpResultCode(resp, err)] {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		delay := ct.retry.backoff(attempt)
+		log.Debug().Str("method", req.Method).Str("url", req.URL.String()).Int("attempt", attempt).Dur("backoff", delay).Msg("retrying request")
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// httpResultCode returns the gRPC code equivalent to the result of a request. Connection errors are
+// considered UNAVAILABLE.
+func httpResultCode(resp *http.Response, err error) codes.Code {
+	if err != nil {
+		return nerrors.ToGRPCCode[nerrors.Unavailable]
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return nerrors.ToGRPCCode[nerrors.OK]
+	}
+	return nerrors.ToGRPCCode[HTTPStatusToErrorCode(resp.StatusCode)]
+}
+
+// HTTPStatusToErrorCode returns the error code equivalent to an HTTP status code.
+func HTTPStatusToErrorCode(statusCode int) nerrors.ErrorCode {
+	if code, exists := httpStatusCodes[statusCode]; exists {
+		return code
+	}
+	switch {
+	case statusCode < http.StatusBadRequest:
+		return nerrors.OK
+	case statusCode < http.StatusInternalServerError:
+		return nerrors.FailedPrecondition
+	default:
+		return nerrors.Internal
+	}
+}
+
+// NewErrorFromResponse builds an error from an HTTP error response. The message is taken from the message or error
+// fields of a JSON body, or from the body itself.
+func NewErrorFromResponse(resp *http.Response) *nerrors.ExtendedError {
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	message := strings.TrimSpace(string(content))
+	body := make(map[string]interface{})
+	if json.Unmarshal(content, &body) == nil {
+		for _, key := range []string{"message", "error"} {
+			if value, ok := body[key].(string); ok && value != "" {
+				message = value
+				break
+			}
+		}
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return nerrors.NewExtendedError(HTTPStatusToErrorCode(resp.StatusCode), "%s %s failed with status %d: %s",
+		resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, message)
+}
+
+// DoJSON sends a request to the given path with the JSON representation of request as body, if not nil, and
+// decodes the JSON response into response, if not nil. HTTP error responses are returned as errors.
+func (hc *HTTPClient) DoJSON(ctx context.Context, method string, path string, request interface{}, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		content, err := json.Marshal(request)
+		if err != nil {
+			return nerrors.NewInvalidArgumentErrorFrom(err, "cannot marshal request")
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, hc.BaseURL+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return nerrors.NewInvalidArgumentErrorFrom(err, "cannot create request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := hc.Client.Do(req)
+	if err != nil {
+		return nerrors.NewUnavailableErrorFrom(err, "cannot send request to %s", hc.BaseURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return NewErrorFromResponse(resp)
+	}
+	if response == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot decode response")
+	}
+	return nil
+}
+
+// GetJSON sends a GET request and decodes the JSON response.
+func (hc *HTTPClient) GetJSON(ctx context.Context, path string, response interface{}) error {
+	return hc.DoJSON(ctx, http.MethodGet, path, nil, response)
+}
+
+// PostJSON sends a POST request with a JSON body and decodes the JSON response.
+func (hc *HTTPClient) PostJSON(ctx context.Context, path string, request interface{}, response interface{}) error {
+	return hc.DoJSON(ctx, http.MethodPost, path, request, response)
+}
@@ -0,0 +1,180 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// testMessage is the payload exchanged with the test HTTP server.
+type testMessage struct {
+	Message string `json:"message"`
+}
+
+var _ = ginkgo.Describe("HTTP client", func() {
+
+	var server *httptest.Server
+	var mutex sync.Mutex
+	var failures int
+	var received http.Header
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = r.Header.Clone()
+		switch r.URL.Path {
+		case "/flaky":
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(&testMessage{Message: "recovered"})
+		case "/echo":
+			request := &testMessage{}
+			_ = json.NewDecoder(r.Body).Decode(request)
+			_ = json.NewEncoder(w).Encode(request)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(&testMessage{Message: "entity not found"})
+		}
+	})
+
+	configFor := func(server *httptest.Server) *Config {
+		serverURL, err := url.Parse(server.URL)
+		gomega.Expect(err).To(gomega.Succeed())
+		port, err := strconv.Atoi(serverURL.Port())
+		gomega.Expect(err).To(gomega.Succeed())
+		return &Config{ServerAddress: serverURL.Hostname(), ServerPort: port}
+	}
+
+	ginkgo.BeforeEach(func() {
+		failures = 0
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.It("should send JSON requests with the standard headers", func() {
+		server = httptest.NewServer(handler)
+		client, err := NewHTTPClient(configFor(server), HTTPOptions{Agent: "test", Version: "v1.0.0", Token: "token", AllowInsecureToken: true})
+		gomega.Expect(err).To(gomega.Succeed())
+
+		response := &testMessage{}
+		gomega.Expect(client.PostJSON(context.Background(), "/echo", &testMessage{Message: "hello"}, response)).To(gomega.Succeed())
+		gomega.Expect(response.Message).To(gomega.Equal("hello"))
+		gomega.Expect(received.Get(AgentHeader)).To(gomega.Equal("test"))
+		gomega.Expect(received.Get(VersionHeader)).To(gomega.Equal("v1.0.0"))
+		gomega.Expect(received.Get(AuthorizationHeader)).To(gomega.Equal("Bearer token"))
+	})
+
+	ginkgo.It("should map error responses", func() {
+		server = httptest.NewServer(handler)
+		client, err := NewHTTPClient(configFor(server), HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		err = client.GetJSON(context.Background(), "/missing", &testMessage{})
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.NotFound))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("entity not found"))
+	})
+
+	ginkgo.It("should retry idempotent requests", func() {
+		server = httptest.NewServer(handler)
+		failures = 2
+		cfg := configFor(server)
+		cfg.Retry.MaxAttempts = 3
+		cfg.Retry.InitialBackoff = time.Millisecond
+		client, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		response := &testMessage{}
+		gomega.Expect(client.GetJSON(context.Background(), "/flaky", response)).To(gomega.Succeed())
+		gomega.Expect(response.Message).To(gomega.Equal("recovered"))
+	})
+
+	ginkgo.It("should not retry without a retry policy", func() {
+		server = httptest.NewServer(handler)
+		failures = 1
+		client, err := NewHTTPClient(configFor(server), HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		err = client.GetJSON(context.Background(), "/flaky", &testMessage{})
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.Unavailable))
+	})
+
+	ginkgo.It("should connect using TLS with a custom CA", func() {
+		server = httptest.NewTLSServer(handler)
+		cfg := configFor(server)
+		cfg.UseTLS = true
+		cfg.ClientCA = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+		client, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		response := &testMessage{}
+		gomega.Expect(client.PostJSON(context.Background(), "/echo", &testMessage{Message: "secure"}, response)).To(gomega.Succeed())
+		gomega.Expect(response.Message).To(gomega.Equal("secure"))
+	})
+
+	ginkgo.It("should use the proxy of the environment unless a proxy is configured", func() {
+		server = httptest.NewServer(handler)
+		cfg := configFor(server)
+		transport, err := newHTTPTransport(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(reflect.ValueOf(transport.Proxy).Pointer()).To(gomega.Equal(reflect.ValueOf(http.ProxyFromEnvironment).Pointer()))
+
+		cfg.Proxy = ProxyConfig{URL: "http://proxy.example.com:3128"}
+		transport, err = newHTTPTransport(cfg)
+		gomega.Expect(err).To(gomega.Succeed())
+		proxyURL, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "napptive.com"}})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(proxyURL.Host).To(gomega.Equal("proxy.example.com:3128"))
+	})
+
+	ginkgo.It("should require a token when authentication is enabled", func() {
+		server = httptest.NewServer(handler)
+		cfg := configFor(server)
+		cfg.AuthEnable = true
+		_, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should not send the token without TLS unless allowed", func() {
+		server = httptest.NewServer(handler)
+		_, err := NewHTTPClient(configFor(server), HTTPOptions{Token: "token"})
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.FailedPrecondition))
+	})
+
+	ginkgo.It("should reject invalid configurations", func() {
+		server = httptest.NewServer(handler)
+		cfg := configFor(server)
+		cfg.ServerPort = -1
+		_, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+})
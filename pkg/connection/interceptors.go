@@ -0,0 +1,253 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TraceParentHeader with the key name of the W3C trace context header.
+const TraceParentHeader = "traceparent"
+
+// traceParentVersion with the supported version of the W3C trace context format.
+const traceParentVersion = "00"
+
+// traceParentRegex validates the format of a traceparent header.
+var traceParentRegex = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// WithUnaryInterceptors returns a dial option that appends the given unary interceptors to the connection.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(interceptors...)
+}
+
+// WithStreamInterceptors returns a dial option that appends the given stream interceptors to the connection.
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) grpc.DialOption {
+	return grpc.WithChainStreamInterceptor(interceptors...)
+}
+
+// LoggingUnaryClientInterceptor returns a client interceptor that logs each call with its duration and status code.
+// Requests and responses are included when the log level is set to trace.
+func LoggingUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		event := logCallEvent(err).Str("method", method).Dur("duration", time.Since(start)).Str("code", status.Code(err).String())
+		if zerolog.GlobalLevel() <= zerolog.TraceLevel {
+			event = event.Interface("request", req)
+			if err == nil {
+				event = event.Interface("response", reply)
+			}
+		}
+		event.Msg("unary call")
+		return err
+	}
+}
+
+// LoggingStreamClientInterceptor returns a client interceptor that logs each stream when it finishes with its
+// duration and status code.
+func LoggingStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return newStreamObserver(func(method string, err error, duration time.Duration) {
+		logCallEvent(err).Str("method", method).Dur("duration", duration).Str("code", status.Code(err).String()).Msg("stream call")
+	})
+}
+
+// logCallEvent returns the log event used to report a call attending to its result.
+func logCallEvent(err error) *zerolog.Event {
+	if err != nil {
+		return log.Warn().Err(err)
+	}
+	return log.Debug()
+}
+
+// MetricsRecorder defines the operations required to collect metrics from the gRPC calls.
+type MetricsRecorder interface {
+	// RecordCall is called once a call finishes with the resulting status code and its latency.
+	RecordCall(method string, code codes.Code, duration time.Duration)
+}
+
+// MetricsUnaryClientInterceptor returns a client interceptor that reports each call to the recorder.
+func MetricsUnaryClientInterceptor(recorder MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		recorder.RecordCall(method, status.Code(err), time.Since(start))
+		return err
+	}
+}
+
+// MetricsStreamClientInterceptor returns a client interceptor that reports each stream to the recorder once it finishes.
+func MetricsStreamClientInterceptor(recorder MetricsRecorder) grpc.StreamClientInterceptor {
+	return newStreamObserver(func(method string, err error, duration time.Duration) {
+		recorder.RecordCall(method, status.Code(err), duration)
+	})
+}
+
+// streamFinishedFunc is called when an observed stream finishes.
+type streamFinishedFunc func(method string, err error, duration time.Duration)
+
+// newStreamObserver returns a stream interceptor that calls onFinish when the stream ends.
+func newStreamObserver(onFinish streamFinishedFunc) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			onFinish(method, err, time.Since(start))
+			return nil, err
+		}
+		return &observedStream{ClientStream: stream, desc: desc, method: method, start: start, onFinish: onFinish}, nil
+	}
+}
+
+// observedStream wraps a client stream to detect when it finishes.
+type observedStream struct {
+	grpc.ClientStream
+	desc     *grpc.StreamDesc
+	method   string
+	start    time.Time
+	onFinish streamFinishedFunc
+	once     sync.Once
+}
+
+// RecvMsg receives a message and reports the end of the stream on error or EOF. Streams without server streaming
+// (e.g., client streaming) finish after receiving their single response.
+func (s *observedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		result := err
+		if err == io.EOF {
+			result = nil
+		}
+		s.once.Do(func() {
+			s.onFinish(s.method, result, time.Since(s.start))
+		})
+	}
+	return err
+}
+
+// TraceParent with the elements of a W3C traceparent header.
+type TraceParent struct {
+	// TraceID with the 16 bytes hex encoded identifier of the whole trace.
+	TraceID string
+	// ParentID with the 8 bytes hex encoded identifier of the calling span.
+	ParentID string
+	// Flags with the hex encoded trace flags.
+	Flags string
+}
+
+// NewTraceParent creates a TraceParent for a new sampled trace.
+func NewTraceParent() TraceParent {
+	return TraceParent{TraceID: randomHex(16), ParentID: randomHex(8), Flags: "01"}
+}
+
+// ParseTraceParent parses the value of a traceparent header.
+func ParseTraceParent(value string) (*TraceParent, error) {
+	matches := traceParentRegex.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil || matches[1] == "ff" {
+		return nil, nerrors.NewInvalidArgumentError("invalid traceparent %q", value)
+	}
+	if strings.Trim(matches[2], "0") == "" || strings.Trim(matches[3], "0") == "" {
+		return nil, nerrors.NewInvalidArgumentError("invalid traceparent %q, identifiers cannot be zero", value)
+	}
+	return &TraceParent{TraceID: matches[2], ParentID: matches[3], Flags: matches[4]}, nil
+}
+
+// Child returns a TraceParent for a new span in the same trace.
+func (tp TraceParent) Child() TraceParent {
+	return TraceParent{TraceID: tp.TraceID, ParentID: randomHex(8), Flags: tp.Flags}
+}
+
+// String returns the header representation of the TraceParent.
+func (tp TraceParent) String() string {
+	return strings.Join([]string{traceParentVersion, tp.TraceID, tp.ParentID, tp.Flags}, "-")
+}
+
+// traceParentKey is the key used to store a TraceParent in a context.
+type traceParentKey struct{}
+
+// ContextWithTraceParent returns a context that propagates the given trace in the outgoing calls.
+func ContextWithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+// TraceParentFromContext extracts the trace to propagate from the context. The trace is taken from a value
+// stored with ContextWithTraceParent or from the incoming metadata of a server call.
+func TraceParentFromContext(ctx context.Context) (*TraceParent, bool) {
+	if tp, ok := ctx.Value(traceParentKey{}).(TraceParent); ok {
+		return &tp, true
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(TraceParentHeader); len(values) > 0 {
+			if tp, err := ParseTraceParent(values[0]); err == nil {
+				return tp, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// injectTraceParent adds the traceparent header to the outgoing metadata unless it is already present.
+func injectTraceParent(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(TraceParentHeader)) > 0 {
+		return ctx
+	}
+	var tp TraceParent
+	if parent, found := TraceParentFromContext(ctx); found {
+		tp = parent.Child()
+	} else {
+		tp = NewTraceParent()
+	}
+	return metadata.AppendToOutgoingContext(ctx, TraceParentHeader, tp.String())
+}
+
+// TraceParentUnaryClientInterceptor returns a client interceptor that propagates the W3C traceparent header. If the
+// context does not contain a trace, a new one is started.
+func TraceParentUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(injectTraceParent(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// TraceParentStreamClientInterceptor returns a client interceptor that propagates the W3C traceparent header in streams.
+func TraceParentStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(injectTraceParent(ctx), desc, cc, method, opts...)
+	}
+}
+
+// randomHex returns a random hex encoded identifier with the given number of bytes.
+func randomHex(size int) string {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		log.Warn().Err(err).Msg("cannot generate random identifier")
+	}
+	return hex.EncodeToString(buffer)
+}
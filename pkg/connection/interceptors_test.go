@@ -0,0 +1,131 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordingHealthServer is a health server that records the metadata of the received calls.
+type recordingHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	received chan metadata.MD
+}
+
+// Check records the incoming metadata.
+func (rs *recordingHealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	rs.received <- md
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// callRecorder is a MetricsRecorder that stores the reported calls.
+type callRecorder struct {
+	sync.Mutex
+	codes []codes.Code
+}
+
+// RecordCall stores the status code of the call.
+func (cr *callRecorder) RecordCall(_ string, code codes.Code, _ time.Duration) {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.codes = append(cr.codes, code)
+}
+
+var _ = ginkgo.Describe("Client interceptors", func() {
+
+	var healthServer *recordingHealthServer
+	var server *grpc.Server
+	var dialer grpc.DialOption
+
+	ginkgo.BeforeEach(func() {
+		healthServer = &recordingHealthServer{received: make(chan metadata.MD, 1)}
+		server, dialer = startBufconnServer(healthServer)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Stop()
+	})
+
+	check := func(ctx context.Context, opts ...grpc.DialOption) error {
+		conn, err := GetNonTLSConnection(&Config{}, "bufnet", append(opts, dialer)...)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	ginkgo.It("should start a new trace", func() {
+		gomega.Expect(check(context.Background(), WithUnaryInterceptors(TraceParentUnaryClientInterceptor()))).To(gomega.Succeed())
+		var md metadata.MD
+		gomega.Eventually(healthServer.received).Should(gomega.Receive(&md))
+		gomega.Expect(md.Get(TraceParentHeader)).To(gomega.HaveLen(1))
+		_, err := ParseTraceParent(md.Get(TraceParentHeader)[0])
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should propagate the trace of the context", func() {
+		parent := NewTraceParent()
+		ctx := ContextWithTraceParent(context.Background(), parent)
+		gomega.Expect(check(ctx, WithUnaryInterceptors(TraceParentUnaryClientInterceptor()))).To(gomega.Succeed())
+		var md metadata.MD
+		gomega.Eventually(healthServer.received).Should(gomega.Receive(&md))
+		received, err := ParseTraceParent(md.Get(TraceParentHeader)[0])
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(received.TraceID).To(gomega.Equal(parent.TraceID))
+		gomega.Expect(received.ParentID).ToNot(gomega.Equal(parent.ParentID))
+	})
+
+	ginkgo.It("should report the calls to the metrics recorder", func() {
+		recorder := &callRecorder{}
+		opts := WithUnaryInterceptors(LoggingUnaryClientInterceptor(), MetricsUnaryClientInterceptor(recorder))
+		gomega.Expect(check(context.Background(), opts)).To(gomega.Succeed())
+		gomega.Expect(recorder.codes).To(gomega.Equal([]codes.Code{codes.OK}))
+	})
+
+	ginkgo.It("should report client streams after their response", func() {
+		recorder := &callRecorder{}
+		streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &finishedStream{}, nil
+		}
+		desc := &grpc.StreamDesc{ClientStreams: true}
+		stream, err := MetricsStreamClientInterceptor(recorder)(context.Background(), desc, nil, "/pkg.Service/Upload", streamer)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(stream.RecvMsg(nil)).To(gomega.Succeed())
+		gomega.Expect(recorder.codes).To(gomega.Equal([]codes.Code{codes.OK}))
+	})
+
+	ginkgo.It("should reject invalid traceparent headers", func() {
+		_, err := ParseTraceParent("00-00000000000000000000000000000000-b7ad6b7169203331-01")
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		_, err = ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331")
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		tp, err := ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(tp.String()).To(gomega.Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"))
+	})
+
+})
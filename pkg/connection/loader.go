@@ -0,0 +1,197 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileFlag with the name of the flag that points to a connection configuration file.
+const ConfigFileFlag = "connection-config"
+
+// ConfigLoader builds a Config from the standard connection flags, the environment variables, and a configuration
+// file. The precedence, from lowest to highest, is: defaults, configuration file, environment variables, and flags
+// explicitly set by the user.
+type ConfigLoader struct {
+	// EnvPrefix with the prefix of the environment variables. For example, with PLAYGROUND the --server flag
+	// is read from PLAYGROUND_SERVER.
+	EnvPrefix string
+	// Defaults with the configuration used as base.
+	Defaults Config
+	// flagConfig contains the values bound to the flags.
+	flagConfig Config
+	// configFile with the path of the configuration file set through the flags.
+	configFile string
+	// flags with the flag set where the flags are registered.
+	flags *pflag.FlagSet
+	// flagNames contains the names of the registered connection flags in registration order.
+	flagNames []string
+	// setters contains the functions that copy the value of a flag into a configuration.
+	setters map[string]func(cfg *Config)
+}
+
+// NewConfigLoader creates a ConfigLoader with a given environment variable prefix and default configuration.
+func NewConfigLoader(envPrefix string, defaults Config) *ConfigLoader {
+	return &ConfigLoader{
+		EnvPrefix: envPrefix,
+		Defaults:  defaults,
+		setters:   make(map[string]func(cfg *Config)),
+	}
+}
+
+// RegisterFlags adds the connection flags as persistent flags of the command so that they are available
+// to all its subcommands.
+func (cl *ConfigLoader) RegisterFlags(cmd *cobra.Command) {
+	cl.flags = cmd.PersistentFlags()
+	cl.flagConfig = cl.Defaults
+	cl.flags.StringVar(&cl.configFile, ConfigFileFlag, "", "Path of a YAML or JSON file with the connection configuration")
+
+	cl.stringFlag("server", "Address of the target server", func(cfg *Config) *string { return &cfg.ServerAddress })
+	cl.intFlag("port", "Port of the target server", func(cfg *Config) *int { return &cfg.ServerPort })
+	cl.stringFlag("load-balancing-policy", "Client-side load balancing policy (e.g., round_robin)", func(cfg *Config) *string { return &cfg.LoadBalancingPolicy })
+	cl.boolFlag("use-tls", "Use TLS to connect to the server", func(cfg *Config) *bool { return &cfg.UseTLS })
+	cl.boolFlag("skip-cert-validation", "Skip the validation of the certificate presented by the server", func(cfg *Config) *bool { return &cfg.SkipCertValidation })
+	cl.stringFlag("client-ca", "CA trusted to validate the server certificate as PEM, base64 encoded PEM, or file path", func(cfg *Config) *string { return &cfg.ClientCA })
+	cl.stringFlag("min-tls-version", "Minimum TLS version accepted (1.0, 1.1, 1.2 or 1.3)", func(cfg *Config) *string { return &cfg.MinTLSVersion })
+	cl.stringFlag("server-name", "Server name used for SNI and certificate validation instead of the server address", func(cfg *Config) *string { return &cfg.ServerName })
+	cl.boolFlag("merge-system-cas", "Trust the system CAs in addition to the client CA", func(cfg *Config) *bool { return &cfg.MergeSystemCAs })
+	cl.boolFlag("auth-enable", "Send authentication information to the server", func(cfg *Config) *bool { return &cfg.AuthEnable })
+	cl.boolFlag("blocking-dial", "Wait until the connection with the server is established", func(cfg *Config) *bool { return &cfg.BlockingDial })
+	cl.durationFlag("connect-timeout", "Maximum time to wait for the connection on blocking dials", func(cfg *Config) *time.Duration { return &cfg.ConnectTimeout })
+	cl.durationFlag("keepalive-time", "Period of inactivity after which the server is pinged", func(cfg *Config) *time.Duration { return &cfg.KeepaliveTime })
+	cl.intFlag("max-recv-msg-size", "Maximum size in bytes of the messages received from the server", func(cfg *Config) *int { return &cfg.MaxRecvMsgSize })
+	cl.stringFlag("compression", "Compressor used on the calls (e.g., gzip)", func(cfg *Config) *string { return &cfg.Compression })
+	cl.stringFlag("proxy", "URL of the HTTP CONNECT proxy used to reach the server", func(cfg *Config) *string { return &cfg.Proxy.URL })
+	cl.stringFlag("no-proxy", "Comma separated list of hosts that are reached without proxy", func(cfg *Config) *string { return &cfg.Proxy.NoProxy })
+	cl.intFlag("max-in-flight", "Maximum number of concurrent calls to the server", func(cfg *Config) *int { return &cfg.RateLimit.MaxInFlight })
+	cl.intFlag("retry-max-attempts", "Maximum number of attempts of the failed calls", func(cfg *Config) *int { return &cfg.Retry.MaxAttempts })
+}
+
+// stringFlag registers a string flag bound to a configuration field.
+func (cl *ConfigLoader) stringFlag(name string, usage string, field func(cfg *Config) *string) {
+	cl.flags.StringVar(field(&cl.flagConfig), name, *field(&cl.Defaults), cl.usage(name, usage))
+	cl.addSetter(name, func(cfg *Config) { *field(cfg) = *field(&cl.flagConfig) })
+}
+
+// intFlag registers an int flag bound to a configuration field.
+func (cl *ConfigLoader) intFlag(name string, usage string, field func(cfg *Config) *int) {
+	cl.flags.IntVar(field(&cl.flagConfig), name, *field(&cl.Defaults), cl.usage(name, usage))
+	cl.addSetter(name, func(cfg *Config) { *field(cfg) = *field(&cl.flagConfig) })
+}
+
+// boolFlag registers a bool flag bound to a configuration field.
+func (cl *ConfigLoader) boolFlag(name string, usage string, field func(cfg *Config) *bool) {
+	cl.flags.BoolVar(field(&cl.flagConfig), name, *field(&cl.Defaults), cl.usage(name, usage))
+	cl.addSetter(name, func(cfg *Config) { *field(cfg) = *field(&cl.flagConfig) })
+}
+
+// durationFlag registers a duration flag bound to a configuration field.
+func (cl *ConfigLoader) durationFlag(name string, usage string, field func(cfg *Config) *time.Duration) {
+	cl.flags.DurationVar(field(&cl.flagConfig), name, *field(&cl.Defaults), cl.usage(name, usage))
+	cl.addSetter(name, func(cfg *Config) { *field(cfg) = *field(&cl.flagConfig) })
+}
+
+// addSetter stores the function that copies the value of a flag into a configuration.
+func (cl *ConfigLoader) addSetter(name string, setter func(cfg *Config)) {
+	cl.flagNames = append(cl.flagNames, name)
+	cl.setters[name] = setter
+}
+
+// usage returns the description of a flag including its environment variable.
+func (cl *ConfigLoader) usage(name string, usage string) string {
+	return usage + " [" + cl.EnvVar(name) + "]"
+}
+
+// EnvVar returns the name of the environment variable associated with a flag.
+func (cl *ConfigLoader) EnvVar(flagName string) string {
+	name := strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+	if cl.EnvPrefix == "" {
+		return name
+	}
+	return strings.ToUpper(cl.EnvPrefix) + "_" + name
+}
+
+// Load returns the configuration resulting from merging the defaults, the configuration file, the environment
+// variables, and the flags. The resulting configuration is validated before being returned.
+func (cl *ConfigLoader) Load() (*Config, error) {
+	cfg, err := cl.LoadWithoutValidation()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadWithoutValidation returns the configuration like Load without validating it, so that invalid configurations
+// can be inspected (e.g., by Diagnose).
+func (cl *ConfigLoader) LoadWithoutValidation() (*Config, error) {
+	if cl.flags == nil {
+		return nil, nerrors.NewFailedPreconditionError("connection flags must be registered before loading the configuration")
+	}
+	cfg := cl.Defaults
+	configFile := cl.configFile
+	if !cl.flags.Changed(ConfigFileFlag) {
+		if value, exists := os.LookupEnv(cl.EnvVar(ConfigFileFlag)); exists {
+			configFile = value
+		}
+	}
+	if configFile != "" {
+		if err := LoadConfigFile(configFile, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range cl.flagNames {
+		if cl.flags.Changed(name) {
+			cl.setters[name](&cfg)
+			continue
+		}
+		value, exists := os.LookupEnv(cl.EnvVar(name))
+		if !exists {
+			continue
+		}
+		if err := cl.flags.Lookup(name).Value.Set(value); err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid value for %s", cl.EnvVar(name))
+		}
+		cl.setters[name](&cfg)
+	}
+	return &cfg, nil
+}
+
+// LoadConfigFile reads a YAML or JSON configuration file and overwrites the fields of cfg that are present in it.
+func LoadConfigFile(path string, cfg *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nerrors.NewNotFoundErrorFrom(err, "cannot read connection configuration file %s", path)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return nerrors.NewInvalidArgumentErrorFrom(err, "cannot parse connection configuration file %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/spf13/cobra"
+)
+
+var _ = ginkgo.Describe("Configuration loading", func() {
+
+	var loader *ConfigLoader
+	var cmd *cobra.Command
+	var configDir string
+	var configFile string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		configDir, err = os.MkdirTemp("", "connection")
+		gomega.Expect(err).To(gomega.Succeed())
+		loader = NewConfigLoader("gutest", Config{ServerAddress: "localhost", ServerPort: 7060})
+		cmd = &cobra.Command{Use: "test"}
+		loader.RegisterFlags(cmd)
+		configFile = filepath.Join(configDir, "connection.yaml")
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(configDir)).To(gomega.Succeed())
+		gomega.Expect(os.Unsetenv("GUTEST_PORT")).To(gomega.Succeed())
+		gomega.Expect(os.Unsetenv("GUTEST_SERVER")).To(gomega.Succeed())
+		gomega.Expect(os.Unsetenv("GUTEST_CONNECTION_CONFIG")).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should return the defaults", func() {
+		gomega.Expect(cmd.ParseFlags([]string{})).To(gomega.Succeed())
+		cfg, err := loader.Load()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.GetEffectiveAddress()).To(gomega.Equal("localhost:7060"))
+	})
+
+	ginkgo.It("should apply the precedence rules", func() {
+		content := "serverAddress: file.napptive.dev\nserverPort: 443\nuseTLS: true\nconnectTimeout: 5s\nretry:\n  maxAttempts: 3\n"
+		gomega.Expect(os.WriteFile(configFile, []byte(content), 0600)).To(gomega.Succeed())
+		gomega.Expect(os.Setenv("GUTEST_CONNECTION_CONFIG", configFile)).To(gomega.Succeed())
+		gomega.Expect(os.Setenv("GUTEST_PORT", "8443")).To(gomega.Succeed())
+		gomega.Expect(os.Setenv("GUTEST_SERVER", "env.napptive.dev")).To(gomega.Succeed())
+		gomega.Expect(cmd.ParseFlags([]string{"--server", "flag.napptive.dev"})).To(gomega.Succeed())
+
+		cfg, err := loader.Load()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.ServerAddress).To(gomega.Equal("flag.napptive.dev"))
+		gomega.Expect(cfg.ServerPort).To(gomega.Equal(8443))
+		gomega.Expect(cfg.UseTLS).To(gomega.BeTrue())
+		gomega.Expect(cfg.ConnectTimeout).To(gomega.Equal(5 * time.Second))
+		gomega.Expect(cfg.Retry.MaxAttempts).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should read JSON files", func() {
+		gomega.Expect(os.WriteFile(configFile, []byte(`{"serverAddress": "json.napptive.dev", "serverPort": 443}`), 0600)).To(gomega.Succeed())
+		gomega.Expect(cmd.ParseFlags([]string{"--" + ConfigFileFlag, configFile})).To(gomega.Succeed())
+		cfg, err := loader.Load()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.GetEffectiveAddress()).To(gomega.Equal("json.napptive.dev:443"))
+	})
+
+	ginkgo.It("should reject unknown fields", func() {
+		gomega.Expect(os.WriteFile(configFile, []byte("serverAdress: typo.napptive.dev\n"), 0600)).To(gomega.Succeed())
+		gomega.Expect(cmd.ParseFlags([]string{"--" + ConfigFileFlag, configFile})).To(gomega.Succeed())
+		_, err := loader.Load()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should load invalid configurations to be diagnosed", func() {
+		gomega.Expect(cmd.ParseFlags([]string{"--port", "0"})).To(gomega.Succeed())
+		cfg, err := loader.LoadWithoutValidation()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.ServerPort).To(gomega.Equal(0))
+		report := Diagnose(context.Background(), cfg)
+		gomega.Expect(report.Checks[0].Name).To(gomega.Equal("configuration"))
+		gomega.Expect(report.Checks[0].Status).To(gomega.Equal(CheckFailed))
+	})
+
+	ginkgo.It("should reject invalid environment values", func() {
+		gomega.Expect(os.Setenv("GUTEST_PORT", "not-a-port")).To(gomega.Succeed())
+		gomega.Expect(cmd.ParseFlags([]string{})).To(gomega.Succeed())
+		_, err := loader.Load()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should load invalid configurations to be diagnosed", func() {
+		gomega.Expect(cmd.ParseFlags([]string{"--port", "0"})).To(gomega.Succeed())
+		cfg, err := loader.LoadWithoutValidation()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.ServerPort).To(gomega.Equal(0))
+		report := Diagnose(context.Background(), cfg)
+		gomega.Expect(report.Checks[0].Name).To(gomega.Equal("configuration"))
+		gomega.Expect(report.Checks[0].Status).To(gomega.Equal(CheckFailed))
+	})
+
+	ginkgo.It("should validate the merged configuration", func() {
+		gomega.Expect(cmd.ParseFlags([]string{"--port", "0"})).To(gomega.Succeed())
+		_, err := loader.Load()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should load invalid configurations to be diagnosed", func() {
+		gomega.Expect(cmd.ParseFlags([]string{"--port", "0"})).To(gomega.Succeed())
+		cfg, err := loader.LoadWithoutValidation()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cfg.ServerPort).To(gomega.Equal(0))
+		report := Diagnose(context.Background(), cfg)
+		gomega.Expect(report.Checks[0].Name).To(gomega.Equal("configuration"))
+		gomega.Expect(report.Checks[0].Status).To(gomega.Equal(CheckFailed))
+	})
+
+})
@@ -0,0 +1,209 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/napptive/go-utils/pkg/validation"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Manager keeps a single shared connection for each registered configuration, identified by its Config.Name.
+// Connections are established the first time they are requested.
+type Manager struct {
+	// mu protects the configurations and connections.
+	mu sync.Mutex
+	// opts contains the dial options applied to all the connections.
+	opts []grpc.DialOption
+	// configs contains the registered configurations indexed by name.
+	configs map[string]*Config
+	// connections contains the established connections indexed by name.
+	connections map[string]*grpc.ClientConn
+	// dials contains the connections being established indexed by name.
+	dials map[string]*pendingDial
+	// closed indicates that the manager has been closed.
+	closed bool
+}
+
+// NewManager creates a Manager whose connections are established with the given dial options.
+func NewManager(opts ...grpc.DialOption) *Manager {
+	return &Manager{
+		opts:        opts,
+		configs:     make(map[string]*Config),
+		connections: make(map[string]*grpc.ClientConn),
+		dials:       make(map[string]*pendingDial),
+	}
+}
+
+// pendingDial with a connection being established. The done channel is closed once the dial finishes.
+type pendingDial struct {
+	done chan struct{}
+	conn *grpc.ClientConn
+	err  error
+}
+
+// Register adds a configuration to the manager. The configuration must have a name that is not already registered.
+func (m *Manager) Register(cfg *Config) error {
+	if err := validation.CheckNotEmpty(cfg.Name, "name"); err != nil {
+		return err
+	}
+	if err := cfg.IsValid(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nerrors.NewFailedPreconditionError("connection manager is closed")
+	}
+	if _, exists := m.configs[cfg.Name]; exists {
+		return nerrors.NewAlreadyExistsError("connection %s is already registered", cfg.Name)
+	}
+	m.configs[cfg.Name] = cfg
+	return nil
+}
+
+// Names returns the names of the registered configurations.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.configs))
+	for name := range m.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetConnection returns the shared connection of a registered configuration, establishing it if required. The dial
+// is performed without holding the lock, so that blocking dials do not delay the requests of other connections, and
+// concurrent requests of the same connection wait for a single dial.
+func (m *Manager) GetConnection(name string) (*grpc.ClientConn, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, nerrors.NewFailedPreconditionError("connection manager is closed")
+	}
+	if conn, exists := m.connections[name]; exists {
+		m.mu.Unlock()
+		return conn, nil
+	}
+	if dial, exists := m.dials[name]; exists {
+		m.mu.Unlock()
+		<-dial.done
+		return dial.conn, dial.err
+	}
+	cfg, exists := m.configs[name]
+	if !exists {
+		m.mu.Unlock()
+		return nil, nerrors.NewNotFoundError("connection %s is not registered", name)
+	}
+	dial := &pendingDial{done: make(chan struct{})}
+	m.dials[name] = dial
+	m.mu.Unlock()
+
+	conn, err := GetConnection(cfg, m.opts...)
+
+	m.mu.Lock()
+	delete(m.dials, name)
+	if err == nil && m.closed {
+		// The manager was closed during the dial.
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Str("name", name).Msg("cannot close connection")
+		}
+		conn, err = nil, nerrors.NewFailedPreconditionError("connection manager is closed")
+	}
+	if err == nil {
+		log.Debug().Str("name", name).Str("target", conn.Target()).Msg("connection established")
+		m.connections[name] = conn
+	}
+	m.mu.Unlock()
+	dial.conn, dial.err = conn, err
+	close(dial.done)
+	return conn, err
+}
+
+// GetState returns the connectivity state of a registered configuration. Connections that have not been
+// established yet are reported as Idle.
+func (m *Manager) GetState(name string) (connectivity.State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.configs[name]; !exists {
+		return connectivity.Shutdown, nerrors.NewNotFoundError("connection %s is not registered", name)
+	}
+	if m.closed {
+		return connectivity.Shutdown, nil
+	}
+	if conn, exists := m.connections[name]; exists {
+		return conn.GetState(), nil
+	}
+	return connectivity.Idle, nil
+}
+
+// WatchState returns a channel that receives the connectivity states of a registered configuration, starting with
+// the current one. The connection is established if required. The channel is closed when the context is done or
+// the connection is shut down.
+func (m *Manager) WatchState(ctx context.Context, name string) (<-chan connectivity.State, error) {
+	conn, err := m.GetConnection(name)
+	if err != nil {
+		return nil, err
+	}
+	states := make(chan connectivity.State, 1)
+	go func() {
+		defer close(states)
+		state := conn.GetState()
+		for {
+			select {
+			case states <- state:
+			case <-ctx.Done():
+				return
+			}
+			if state == connectivity.Shutdown || !conn.WaitForStateChange(ctx, state) {
+				return
+			}
+			state = conn.GetState()
+		}
+	}()
+	return states, nil
+}
+
+// Close closes all the established connections. The manager cannot be used after being closed. Calling Close
+// more than once has no effect.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	failed := make([]string, 0)
+	for name, conn := range m.connections {
+		if err := conn.Close(); err != nil {
+			log.Warn().Err(err).Str("name", name).Msg("cannot close connection")
+			failed = append(failed, name)
+		}
+	}
+	m.connections = make(map[string]*grpc.ClientConn)
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return nerrors.NewInternalError("cannot close connections: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
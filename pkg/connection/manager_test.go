@@ -0,0 +1,131 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = ginkgo.Describe("Connection manager", func() {
+
+	var servers []*grpc.Server
+	var manager *Manager
+
+	startServer := func(name string) *Config {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		gomega.Expect(err).To(gomega.Succeed())
+		server := grpc.NewServer()
+		grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		servers = append(servers, server)
+		return &Config{Name: name, ServerAddress: "127.0.0.1", ServerPort: listener.Addr().(*net.TCPAddr).Port}
+	}
+
+	ginkgo.BeforeEach(func() {
+		servers = make([]*grpc.Server, 0)
+		manager = NewManager()
+		gomega.Expect(manager.Register(startServer("catalog"))).To(gomega.Succeed())
+		gomega.Expect(manager.Register(startServer("users"))).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(manager.Close()).To(gomega.Succeed())
+		for _, server := range servers {
+			server.Stop()
+		}
+	})
+
+	ginkgo.It("should reject duplicated and unnamed configurations", func() {
+		gomega.Expect(nerrors.FromError(manager.Register(startServer("catalog"))).Code).To(gomega.Equal(nerrors.AlreadyExists))
+		gomega.Expect(manager.Register(startServer(""))).ToNot(gomega.Succeed())
+		gomega.Expect(manager.Names()).To(gomega.Equal([]string{"catalog", "users"}))
+	})
+
+	ginkgo.It("should lazily establish shared connections", func() {
+		state, err := manager.GetState("catalog")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(state).To(gomega.Equal(connectivity.Idle))
+
+		first, err := manager.GetConnection("catalog")
+		gomega.Expect(err).To(gomega.Succeed())
+		second, err := manager.GetConnection("catalog")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(second).To(gomega.BeIdenticalTo(first))
+
+		_, err = manager.GetConnection("unknown")
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.NotFound))
+	})
+
+	ginkgo.It("should not block other connections while dialing", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		gomega.Expect(err).To(gomega.Succeed())
+		port := listener.Addr().(*net.TCPAddr).Port
+		gomega.Expect(listener.Close()).To(gomega.Succeed())
+		unreachable := &Config{Name: "unreachable", ServerAddress: "127.0.0.1", ServerPort: port, BlockingDial: true, ConnectTimeout: 2 * time.Second}
+		gomega.Expect(manager.Register(unreachable)).To(gomega.Succeed())
+
+		results := make(chan error, 2)
+		for index := 0; index < 2; index++ {
+			go func() {
+				_, err := manager.GetConnection("unreachable")
+				results <- err
+			}()
+		}
+		start := time.Now()
+		gomega.Eventually(func() (connectivity.State, error) {
+			return manager.GetState("unreachable")
+		}).Should(gomega.Equal(connectivity.Idle))
+		_, err = manager.GetConnection("catalog")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", time.Second))
+		gomega.Eventually(results, 5*time.Second).Should(gomega.Receive(gomega.HaveOccurred()))
+		gomega.Eventually(results, 5*time.Second).Should(gomega.Receive(gomega.HaveOccurred()))
+	})
+
+	ginkgo.It("should report the connectivity state changes", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		states, err := manager.WatchState(ctx, "users")
+		gomega.Expect(err).To(gomega.Succeed())
+		conn, err := manager.GetConnection("users")
+		gomega.Expect(err).To(gomega.Succeed())
+		conn.Connect()
+		gomega.Eventually(states, 5*time.Second).Should(gomega.Receive(gomega.Equal(connectivity.Ready)))
+	})
+
+	ginkgo.It("should close all the connections", func() {
+		conn, err := manager.GetConnection("catalog")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(manager.Close()).To(gomega.Succeed())
+		gomega.Expect(conn.GetState()).To(gomega.Equal(connectivity.Shutdown))
+		_, err = manager.GetConnection("users")
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.FailedPrecondition))
+	})
+
+})
@@ -0,0 +1,236 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// SPKIPinPrefix with the prefix of the pins computed over the subject public key info of a certificate. The
+// digest is base64 encoded, following the format used by curl --pinnedpubkey.
+const SPKIPinPrefix = "sha256/"
+
+// CertificatePinPrefix with the prefix of the pins computed over the whole certificate. The digest is hex encoded
+// with optional colons, following the format printed by openssl x509 -fingerprint -sha256.
+const CertificatePinPrefix = "sha256:"
+
+// PinRecorder is called with the SPKI pin of the server certificate accepted in trust on first use mode.
+type PinRecorder func(pin string) error
+
+// certificatePin with a parsed pin.
+type certificatePin struct {
+	// spki indicates that the digest is computed over the subject public key info instead of the whole certificate.
+	spki bool
+	// digest with the SHA-256 digest.
+	digest []byte
+}
+
+// matches checks if the pin matches a certificate.
+func (cp certificatePin) matches(certificate *x509.Certificate) bool {
+	content := certificate.Raw
+	if cp.spki {
+		content = certificate.RawSubjectPublicKeyInfo
+	}
+	digest := sha256.Sum256(content)
+	return bytes.Equal(digest[:], cp.digest)
+}
+
+// SPKIPin returns the SPKI pin of a certificate.
+func SPKIPin(certificate *x509.Certificate) string {
+	digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return SPKIPinPrefix + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// CertificatePin returns the pin of a whole certificate.
+func CertificatePin(certificate *x509.Certificate) string {
+	digest := sha256.Sum256(certificate.Raw)
+	return CertificatePinPrefix + hex.EncodeToString(digest[:])
+}
+
+// parsePin parses a SPKI or certificate pin.
+func parsePin(pin string) (certificatePin, error) {
+	var result certificatePin
+	var err error
+	switch {
+	case strings.HasPrefix(pin, SPKIPinPrefix):
+		result.spki = true
+		result.digest, err = base64.StdEncoding.DecodeString(pin[len(SPKIPinPrefix):])
+	case strings.HasPrefix(pin, CertificatePinPrefix):
+		result.digest, err = hex.DecodeString(strings.ReplaceAll(pin[len(CertificatePinPrefix):], ":", ""))
+	default:
+		return result, nerrors.NewInvalidArgumentError("pin %q must start with %s or %s", pin, SPKIPinPrefix, CertificatePinPrefix)
+	}
+	if err != nil {
+		return result, nerrors.NewInvalidArgumentErrorFrom(err, "cannot decode pin %q", pin)
+	}
+	if len(result.digest) != sha256.Size {
+		return result, nerrors.NewInvalidArgumentError("pin %q is not a SHA-256 digest", pin)
+	}
+	return result, nil
+}
+
+// parsePins parses a list of pins.
+func parsePins(pins []string) ([]certificatePin, error) {
+	result := make([]certificatePin, 0, len(pins))
+	for _, pin := range pins {
+		parsed, err := parsePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// pinVerifier verifies the certificates presented by the server against a set of pins.
+type pinVerifier struct {
+	sync.Mutex
+	// pins with the accepted pins.
+	pins []certificatePin
+	// trustOnFirstUse accepts the first certificate presented if there are no pins.
+	trustOnFirstUse bool
+	// recorder is called with the pin accepted on first use.
+	recorder PinRecorder
+	// roots with the CAs used to verify the chain when the server certificate is not pinned.
+	roots *x509.CertPool
+	// serverName with the name used to verify the chain. If empty, the name of the connection state is used.
+	serverName string
+}
+
+// verify is a tls.Config VerifyConnection callback. The connection is accepted if the server certificate matches a
+// pin, as the handshake proves that the server owns its private key. Otherwise, the chain is verified as usual and
+// any certificate of the verified chains must match a pin.
+func (pv *pinVerifier) verify(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return nerrors.NewUnauthenticatedError("server did not present any certificate")
+	}
+	leaf := state.PeerCertificates[0]
+
+	pv.Lock()
+	defer pv.Unlock()
+	if len(pv.pins) == 0 && pv.trustOnFirstUse {
+		pin := SPKIPin(leaf)
+		log.Warn().Str("pin", pin).Str("subject", leaf.Subject.String()).Msg("trusting server certificate on first use")
+		if pv.recorder != nil {
+			if err := pv.recorder(pin); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "cannot record certificate pin")
+			}
+		}
+		parsed, _ := parsePin(pin)
+		pv.pins = append(pv.pins, parsed)
+		return nil
+	}
+	if pv.matches(leaf) {
+		return nil
+	}
+
+	serverName := pv.serverName
+	if serverName == "" {
+		serverName = state.ServerName
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{Roots: pv.roots, DNSName: serverName, Intermediates: intermediates})
+	if err != nil {
+		return nerrors.NewUnauthenticatedErrorFrom(err, "server certificate %s does not match any pinned certificate", SPKIPin(leaf))
+	}
+	for _, chain := range chains {
+		for _, certificate := range chain {
+			if pv.matches(certificate) {
+				return nil
+			}
+		}
+	}
+	return nerrors.NewUnauthenticatedError("server certificate chain of %s does not match any pinned certificate", SPKIPin(leaf))
+}
+
+// matches checks if a certificate matches any pin.
+func (pv *pinVerifier) matches(certificate *x509.Certificate) bool {
+	for _, pin := range pv.pins {
+		if pin.matches(certificate) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPinning configures the pin verification on a TLS configuration. As pinned server certificates are usually not
+// signed by a trusted CA, the standard verification is disabled and the chain is verified by the pin verifier when
+// the server certificate is not pinned.
+func applyPinning(cfg *Config, tlsConfig *tls.Config) error {
+	if len(cfg.CertificatePins) == 0 && !cfg.TrustOnFirstUse {
+		return nil
+	}
+	pins, err := parsePins(cfg.CertificatePins)
+	if err != nil {
+		return err
+	}
+	verifier := &pinVerifier{
+		pins:            pins,
+		trustOnFirstUse: cfg.TrustOnFirstUse,
+		recorder:        cfg.PinRecorder,
+		roots:           tlsConfig.RootCAs,
+		serverName:      tlsConfig.ServerName,
+	}
+	if verifier.serverName == "" {
+		// IP addresses are not sent in the SNI extension, so the connection state does not contain them.
+		if host, _, err := net.SplitHostPort(cfg.GetHostPort()); err == nil {
+			verifier.serverName = trimBrackets(host)
+		}
+	}
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = verifier.verify
+	return nil
+}
+
+// ProfilePinRecorder returns a PinRecorder that stores the pin in a profile of the profiles file, so that the
+// certificate accepted on first use is verified on the next connections.
+func ProfilePinRecorder(path string, name string) PinRecorder {
+	return func(pin string) error {
+		return UpdateProfiles(path, func(profiles *Profiles) error {
+			profile, err := profiles.Get(name)
+			if err != nil {
+				return err
+			}
+			profile.AddPin(pin)
+			return nil
+		})
+	}
+}
+
+// AddPin adds a certificate pin to the profile if it is not already present.
+func (p *Profile) AddPin(pin string) {
+	for _, existing := range p.CertificatePins {
+		if existing == pin {
+			return
+		}
+	}
+	p.CertificatePins = append(p.CertificatePins, pin)
+}
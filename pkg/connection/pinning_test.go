@@ -0,0 +1,207 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// newTestCertificate creates a certificate for 127.0.0.1 signed by the given parent, or self-signed if the parent is
+// nil. CA certificates are created if isCA is set.
+func newTestCertificate(parent *tls.Certificate, isCA bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "pinning test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	gomega.Expect(err).To(gomega.Succeed())
+	certificate, err := x509.ParseCertificate(der)
+	gomega.Expect(err).To(gomega.Succeed())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: certificate}
+}
+
+var _ = ginkgo.Describe("Certificate pinning", func() {
+
+	var server *httptest.Server
+	var cfg *Config
+
+	ginkgo.BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"message":"pinned"}`))
+		}))
+		cfg = &Config{Name: "pinned", ServerAddress: "127.0.0.1", ServerPort: server.Listener.Addr().(*net.TCPAddr).Port, UseTLS: true}
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(cfg *Config) error {
+		client, err := NewHTTPClient(cfg, HTTPOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return client.GetJSON(context.Background(), "/", &testMessage{})
+	}
+
+	ginkgo.It("should parse SPKI and certificate pins", func() {
+		gomega.Expect(parsePins([]string{SPKIPin(server.Certificate()), CertificatePin(server.Certificate())})).To(gomega.HaveLen(2))
+		for _, invalid := range []string{"md5:abcd", "sha256/not-base64!", "sha256:abcd"} {
+			_, err := parsePin(invalid)
+			gomega.Expect(err).ToNot(gomega.Succeed(), invalid)
+		}
+	})
+
+	ginkgo.It("should reject untrusted certificates without pins", func() {
+		gomega.Expect(get(cfg)).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept untrusted certificates matching a SPKI pin", func() {
+		cfg.CertificatePins = []string{SPKIPin(server.Certificate())}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+		gomega.Expect(get(cfg)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept certificate fingerprints in openssl format", func() {
+		digest := strings.TrimPrefix(CertificatePin(server.Certificate()), CertificatePinPrefix)
+		pairs := make([]string, 0, len(digest)/2)
+		for index := 0; index < len(digest); index += 2 {
+			pairs = append(pairs, strings.ToUpper(digest[index:index+2]))
+		}
+		cfg.CertificatePins = []string{CertificatePinPrefix + strings.Join(pairs, ":")}
+		gomega.Expect(get(cfg)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject certificates not matching the pins", func() {
+		cfg.CertificatePins = []string{SPKIPin(server.Certificate())}
+		other := httptest.NewTLSServer(http.NotFoundHandler())
+		defer other.Close()
+		cfg.ServerPort = other.Listener.Addr().(*net.TCPAddr).Port
+		gomega.Expect(get(cfg)).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.Context("with a pinned CA", func() {
+
+		var ca tls.Certificate
+		var chainServer *httptest.Server
+
+		// startServer launches a TLS server presenting the leaf followed by the CA certificate.
+		startServer := func(leaf tls.Certificate) {
+			leaf.Certificate = append(leaf.Certificate, ca.Certificate[0])
+			chainServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"message":"pinned"}`))
+			}))
+			chainServer.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+			chainServer.StartTLS()
+			cfg.ServerPort = chainServer.Listener.Addr().(*net.TCPAddr).Port
+			cfg.CertificatePins = []string{SPKIPin(ca.Leaf)}
+		}
+
+		ginkgo.BeforeEach(func() {
+			ca = newTestCertificate(nil, true)
+		})
+
+		ginkgo.AfterEach(func() {
+			chainServer.Close()
+		})
+
+		ginkgo.It("should accept a trusted chain including the pinned CA", func() {
+			startServer(newTestCertificate(&ca, false))
+			cfg.ClientCA = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Leaf.Raw}))
+			gomega.Expect(get(cfg)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject an unrelated certificate presented along the pinned CA", func() {
+			startServer(newTestCertificate(nil, false))
+			cfg.ClientCA = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Leaf.Raw}))
+			gomega.Expect(get(cfg)).ToNot(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject a chain including the pinned CA that is not trusted", func() {
+			startServer(newTestCertificate(&ca, false))
+			gomega.Expect(get(cfg)).ToNot(gomega.Succeed())
+		})
+	})
+
+	ginkgo.It("should validate the pinning options", func() {
+		cfg.CertificatePins = []string{"invalid"}
+		cfg.UseTLS = false
+		cfg.SkipCertValidation = true
+		err := cfg.IsValid()
+		gomega.Expect(err).ToNot(gomega.Succeed())
+		for _, field := range []string{"certificatePins", "useTLS", "skipCertValidation"} {
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(field))
+		}
+	})
+
+	ginkgo.It("should record the pin in the profile on first use", func() {
+		dir, err := os.MkdirTemp("", "pinning")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, ProfilesFileName)
+		gomega.Expect(UpdateProfiles(path, func(profiles *Profiles) error {
+			return profiles.Add(Profile{Config: *cfg})
+		})).To(gomega.Succeed())
+
+		cfg.TrustOnFirstUse = true
+		cfg.PinRecorder = ProfilePinRecorder(path, cfg.Name)
+		gomega.Expect(get(cfg)).To(gomega.Succeed())
+
+		profiles, err := LoadProfiles(path)
+		gomega.Expect(err).To(gomega.Succeed())
+		profile, err := profiles.Get(cfg.Name)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(profile.CertificatePins).To(gomega.Equal([]string{SPKIPin(server.Certificate())}))
+		profile.PinRecorder = func(pin string) error {
+			ginkgo.Fail("pin must not be recorded twice")
+			return nil
+		}
+		gomega.Expect(get(&profile.Config)).To(gomega.Succeed())
+	})
+})
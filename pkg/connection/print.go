@@ -0,0 +1,40 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"reflect"
+
+	"github.com/napptive/go-utils/pkg/printer"
+)
+
+// printResult prints a result with the given printer. If the printer is a TablePrinter without a template for the
+// result type, the result is rendered by a private TablePrinter with the default template, so that the printer of
+// the caller is never modified.
+func printResult(resultPrinter printer.ResultPrinter, result interface{}, tableTemplate string) error {
+	if tp, ok := resultPrinter.(*printer.TablePrinter); ok {
+		if _, err := tp.GetTemplate(result); err != nil {
+			private, err := printer.NewTablePrinter()
+			if err != nil {
+				return err
+			}
+			private.(*printer.TablePrinter).AddTemplate(reflect.TypeOf(result), tableTemplate)
+			return private.Print(result)
+		}
+	}
+	return resultPrinter.Print(result)
+}
@@ -0,0 +1,36 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"github.com/napptive/go-utils/pkg/printer"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Result printing", func() {
+
+	ginkgo.It("should not register templates on the printer of the caller", func() {
+		resultPrinter, err := printer.NewTablePrinter()
+		gomega.Expect(err).To(gomega.Succeed())
+		methods := &MethodList{Service: "pkg.Service"}
+		gomega.Expect(printResult(resultPrinter, methods, MethodListTemplate)).To(gomega.Succeed())
+		_, err = resultPrinter.(*printer.TablePrinter).GetTemplate(methods)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+})
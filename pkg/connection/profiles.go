@@ -0,0 +1,252 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// ProfilesFileName with the default name of the file that stores the connection profiles.
+const ProfilesFileName = "profiles.yaml"
+
+// ProfilesLockTimeout with the maximum time to wait for the lock of the profiles file.
+const ProfilesLockTimeout = 10 * time.Second
+
+// profilesStaleLockAge with the age after which a lock is considered abandoned by a crashed process.
+const profilesStaleLockAge = time.Minute
+
+// profilesLockRetryInterval with the time between attempts to acquire the lock of the profiles file.
+const profilesLockRetryInterval = 50 * time.Millisecond
+
+// Credentials contains the authentication information associated with a profile.
+type Credentials struct {
+	// Token with the access token sent to the server.
+	Token string `json:"token,omitempty" yaml:"token,omitempty" redact:"true"`
+	// RefreshToken with the token used to obtain a new access token.
+	RefreshToken string `json:"refreshToken,omitempty" yaml:"refreshToken,omitempty" redact:"true"`
+}
+
+// Profile with a named connection configuration and its credentials. The name of the profile is the Config.Name.
+type Profile struct {
+	Config `yaml:",inline"`
+	// Credentials associated with the profile.
+	Credentials Credentials `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+}
+
+// Profiles contains a set of connection profiles and a pointer to the one in use, similar to a kubeconfig file.
+type Profiles struct {
+	// CurrentContext with the name of the profile in use.
+	CurrentContext string `json:"currentContext,omitempty" yaml:"currentContext,omitempty"`
+	// Profiles contains the available profiles.
+	Profiles []Profile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+// DefaultProfilesPath returns the path of the profiles file inside a directory of the user home (e.g., .napptive).
+func DefaultProfilesPath(dirName string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nerrors.NewInternalErrorFrom(err, "cannot determine the user home directory")
+	}
+	return filepath.Join(home, dirName, ProfilesFileName), nil
+}
+
+// LoadProfiles reads the profiles stored in a file. An empty set of profiles is returned if the file does not exist.
+func LoadProfiles(path string) (*Profiles, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Profiles{}, nil
+		}
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot read profiles file %s", path)
+	}
+	profiles := &Profiles{}
+	if err := yaml.NewDecoder(bytes.NewReader(content)).Decode(profiles); err != nil && err != io.EOF {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "cannot parse profiles file %s", path)
+	}
+	return profiles, nil
+}
+
+// Save writes the profiles to a file. The content is written to a temporary file that replaces the target
+// one so that readers never observe a partially written file.
+func (p *Profiles) Save(path string) error {
+	content, err := yaml.Marshal(p)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot marshal profiles")
+	}
+	return writeFileAtomically(path, content)
+}
+
+// List returns the available profiles.
+func (p *Profiles) List() []Profile {
+	return p.Profiles
+}
+
+// Get returns the profile with the given name.
+func (p *Profiles) Get(name string) (*Profile, error) {
+	index := p.indexOf(name)
+	if index < 0 {
+		return nil, nerrors.NewNotFoundError("profile %s not found", name)
+	}
+	return &p.Profiles[index], nil
+}
+
+// Current returns the profile in use.
+func (p *Profiles) Current() (*Profile, error) {
+	if p.CurrentContext == "" {
+		return nil, nerrors.NewFailedPreconditionError("no profile is in use")
+	}
+	return p.Get(p.CurrentContext)
+}
+
+// Use sets the profile with the given name as the one in use.
+func (p *Profiles) Use(name string) error {
+	if p.indexOf(name) < 0 {
+		return nerrors.NewNotFoundError("profile %s not found", name)
+	}
+	p.CurrentContext = name
+	return nil
+}
+
+// Add stores a new profile. The first profile added is set as the one in use.
+func (p *Profiles) Add(profile Profile) error {
+	if profile.Name == "" {
+		return nerrors.NewInvalidArgumentError("profile name cannot be empty")
+	}
+	if p.indexOf(profile.Name) >= 0 {
+		return nerrors.NewAlreadyExistsError("profile %s already exists", profile.Name)
+	}
+	if err := profile.IsValid(); err != nil {
+		return err
+	}
+	p.Profiles = append(p.Profiles, profile)
+	if p.CurrentContext == "" {
+		p.CurrentContext = profile.Name
+	}
+	return nil
+}
+
+// Delete removes the profile with the given name. If the profile is in use, no profile remains selected.
+func (p *Profiles) Delete(name string) error {
+	index := p.indexOf(name)
+	if index < 0 {
+		return nerrors.NewNotFoundError("profile %s not found", name)
+	}
+	p.Profiles = append(p.Profiles[:index], p.Profiles[index+1:]...)
+	if p.CurrentContext == name {
+		p.CurrentContext = ""
+	}
+	return nil
+}
+
+// indexOf returns the position of the profile with the given name or -1 if it does not exist.
+func (p *Profiles) indexOf(name string) int {
+	for index, profile := range p.Profiles {
+		if profile.Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+// UpdateProfiles loads the profiles stored in a file, applies the given update, and saves the result. The file is
+// locked during the whole operation so that concurrent invocations do not overwrite each other changes. The file is
+// not modified if the update fails.
+func UpdateProfiles(path string, update func(profiles *Profiles) error) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if err := update(profiles); err != nil {
+		return err
+	}
+	return profiles.Save(path)
+}
+
+// lockFile acquires an exclusive lock over a file by creating a companion lock file. It returns the function that
+// releases the lock.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot create directory for %s", path)
+	}
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(ProfilesLockTimeout)
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = lock.Close()
+			return func() {
+				if err := os.Remove(lockPath); err != nil {
+					log.Warn().Err(err).Str("path", lockPath).Msg("cannot release lock")
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, nerrors.NewInternalErrorFrom(err, "cannot lock %s", path)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > profilesStaleLockAge {
+			log.Warn().Str("path", lockPath).Msg("removing stale lock")
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, nerrors.NewUnavailableError("timeout waiting for the lock of %s", path)
+		}
+		time.Sleep(profilesLockRetryInterval)
+	}
+}
+
+// writeFileAtomically writes the content to a temporary file in the same directory and renames it to the target path.
+func writeFileAtomically(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot create directory %s", dir)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot create temporary file in %s", dir)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return nerrors.NewInternalErrorFrom(err, "cannot write %s", tmp.Name())
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return nerrors.NewInternalErrorFrom(err, "cannot sync %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot close %s", tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "cannot replace %s", path)
+	}
+	return nil
+}
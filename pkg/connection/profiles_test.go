@@ -0,0 +1,117 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Connection profiles", func() {
+
+	var dir string
+	var path string
+
+	newProfile := func(name string) Profile {
+		return Profile{
+			Config:      Config{Name: name, ServerAddress: name + ".napptive.dev", ServerPort: 443, UseTLS: true},
+			Credentials: Credentials{Token: "token-" + name},
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "profiles")
+		gomega.Expect(err).To(gomega.Succeed())
+		path = filepath.Join(dir, ".napptive", ProfilesFileName)
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should return empty profiles if the file does not exist", func() {
+		profiles, err := LoadProfiles(path)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(profiles.List()).To(gomega.BeEmpty())
+		_, err = profiles.Current()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should add, use and delete profiles", func() {
+		profiles := &Profiles{}
+		gomega.Expect(profiles.Add(newProfile("playground"))).To(gomega.Succeed())
+		gomega.Expect(profiles.Add(newProfile("staging"))).To(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(profiles.Add(newProfile("staging"))).Code).To(gomega.Equal(nerrors.AlreadyExists))
+		gomega.Expect(profiles.Add(Profile{Config: Config{Name: "invalid"}})).ToNot(gomega.Succeed())
+
+		current, err := profiles.Current()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(current.Name).To(gomega.Equal("playground"))
+
+		gomega.Expect(profiles.Use("staging")).To(gomega.Succeed())
+		gomega.Expect(profiles.Use("production")).ToNot(gomega.Succeed())
+		gomega.Expect(profiles.CurrentContext).To(gomega.Equal("staging"))
+
+		gomega.Expect(profiles.Delete("staging")).To(gomega.Succeed())
+		gomega.Expect(profiles.CurrentContext).To(gomega.BeEmpty())
+		gomega.Expect(profiles.List()).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should save and load the profiles", func() {
+		profiles := &Profiles{}
+		gomega.Expect(profiles.Add(newProfile("playground"))).To(gomega.Succeed())
+		gomega.Expect(profiles.Save(path)).To(gomega.Succeed())
+
+		loaded, err := LoadProfiles(path)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(loaded).To(gomega.Equal(profiles))
+	})
+
+	ginkgo.It("should support concurrent updates", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(name string) {
+				defer ginkgo.GinkgoRecover()
+				defer wg.Done()
+				gomega.Expect(UpdateProfiles(path, func(profiles *Profiles) error {
+					return profiles.Add(newProfile(name))
+				})).To(gomega.Succeed())
+			}(fmt.Sprintf("profile-%d", i))
+		}
+		wg.Wait()
+
+		profiles, err := LoadProfiles(path)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(profiles.List()).To(gomega.HaveLen(10))
+	})
+
+	ginkgo.It("should not save failed updates", func() {
+		gomega.Expect(UpdateProfiles(path, func(profiles *Profiles) error {
+			return profiles.Use("missing")
+		})).ToNot(gomega.Succeed())
+		gomega.Expect(path).ToNot(gomega.BeAnExistingFile())
+	})
+
+})
@@ -0,0 +1,168 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/napptive/go-utils/pkg/validation"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"golang.org/x/net/http/httpproxy"
+	"google.golang.org/grpc"
+)
+
+// ProxyAuthorizationHeader with the name of the header that contains the proxy credentials.
+const ProxyAuthorizationHeader = "Proxy-Authorization"
+
+// ProxyConfig contains the options of the HTTP CONNECT proxy used to reach the server.
+type ProxyConfig struct {
+	// URL of the proxy (e.g., http://proxy.corp:3128). The proxy is disabled if empty.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Username for the basic authentication with the proxy.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	// Password for the basic authentication with the proxy.
+	Password string `json:"password,omitempty" yaml:"password,omitempty" redact:"true"`
+	// NoProxy with a comma separated list of hosts, domains, IPs, or CIDRs that are reached directly, following
+	// the NO_PROXY conventions. Loopback addresses are never proxied.
+	NoProxy string `json:"noProxy,omitempty" yaml:"noProxy,omitempty"`
+}
+
+// Enabled returns true if a proxy is configured.
+func (pc ProxyConfig) Enabled() bool {
+	return pc.URL != ""
+}
+
+// IsValid checks if the proxy options are valid.
+func (pc ProxyConfig) IsValid() error {
+	if !pc.Enabled() {
+		if pc.Username != "" || pc.Password != "" || pc.NoProxy != "" {
+			return nerrors.NewInvalidArgumentError("proxy url is required to set the proxy options")
+		}
+		return nil
+	}
+	proxyURL, err := url.Parse(pc.URL)
+	if err != nil {
+		return nerrors.NewInvalidArgumentErrorFrom(err, "invalid proxy url")
+	}
+	if proxyURL.Scheme != "http" {
+		return nerrors.NewInvalidArgumentError("proxy url must use the http scheme")
+	}
+	if proxyURL.User != nil {
+		return nerrors.NewInvalidArgumentError("proxy url cannot contain credentials, use the username and password options")
+	}
+	if err := validation.CheckNotEmpty(proxyURL.Hostname(), "proxy host"); err != nil {
+		return err
+	}
+	if pc.Password != "" && pc.Username == "" {
+		return nerrors.NewInvalidArgumentError("proxy username is required if a password is set")
+	}
+	return nil
+}
+
+// ProxyFor returns the URL of the proxy to use to reach the target URL, or nil if the target must be reached directly.
+// The returned URL includes the proxy credentials.
+func (pc ProxyConfig) ProxyFor(target *url.URL) (*url.URL, error) {
+	if !pc.Enabled() {
+		return nil, nil
+	}
+	proxyFunc := (&httpproxy.Config{HTTPProxy: pc.URL, HTTPSProxy: pc.URL, NoProxy: pc.NoProxy}).ProxyFunc()
+	proxyURL, err := proxyFunc(target)
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid proxy url")
+	}
+	if proxyURL != nil && pc.Username != "" {
+		proxyURL.User = url.UserPassword(pc.Username, pc.Password)
+	}
+	return proxyURL, nil
+}
+
+// proxyDialOption returns the dial option that connects through the proxy.
+func (pc ProxyConfig) proxyDialOption() grpc.DialOption {
+	dialer := &net.Dialer{}
+	return grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		proxyURL, err := pc.ProxyFor(&url.URL{Scheme: "https", Host: address})
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL == nil {
+			return dialer.DialContext(ctx, "tcp", address)
+		}
+		return dialThroughProxy(ctx, dialer, proxyURL, address)
+	})
+}
+
+// dialThroughProxy opens a tunnel with the address using the HTTP CONNECT method of the proxy.
+func dialThroughProxy(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return nil, nerrors.NewUnavailableErrorFrom(err, "cannot connect to proxy %s", proxyAddress)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set(ProxyAuthorizationHeader, "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, nerrors.NewUnavailableErrorFrom(err, "cannot send CONNECT request to proxy %s", proxyAddress)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nerrors.NewUnavailableErrorFrom(err, "cannot read CONNECT response from proxy %s", proxyAddress)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, nerrors.NewUnavailableError("proxy %s refused to connect to %s: %s", proxyAddress, address, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were already read into a buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer before reading from the connection.
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.reader.Read(b)
+}
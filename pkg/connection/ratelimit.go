@@ -0,0 +1,298 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// LimitPolicy contains the rate and concurrency limits applied to the calls.
+type LimitPolicy struct {
+	// RequestsPerSecond with the sustained rate of calls allowed. Unlimited if zero.
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty" yaml:"requestsPerSecond,omitempty"`
+	// Burst with the number of calls allowed at once above the sustained rate. Defaults to the rate rounded up.
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// MaxInFlight with the maximum number of concurrent calls. Unlimited if zero.
+	MaxInFlight int `json:"maxInFlight,omitempty" yaml:"maxInFlight,omitempty"`
+}
+
+// Enabled returns true if the policy limits the calls.
+func (lp LimitPolicy) Enabled() bool {
+	return lp.RequestsPerSecond > 0 || lp.MaxInFlight > 0
+}
+
+// IsValid checks if the policy options are valid.
+func (lp LimitPolicy) IsValid() error {
+	if lp.RequestsPerSecond < 0 {
+		return nerrors.NewInvalidArgumentError("requestsPerSecond cannot be negative")
+	}
+	if lp.Burst < 0 {
+		return nerrors.NewInvalidArgumentError("burst cannot be negative")
+	}
+	if lp.Burst > 0 && lp.RequestsPerSecond == 0 {
+		return nerrors.NewInvalidArgumentError("burst requires requestsPerSecond")
+	}
+	if lp.MaxInFlight < 0 {
+		return nerrors.NewInvalidArgumentError("maxInFlight cannot be negative")
+	}
+	return nil
+}
+
+// RateLimitConfig contains the client-side limits of a connection. The default policy is shared by all the
+// methods without an override, while each override key has its own limits.
+type RateLimitConfig struct {
+	// LimitPolicy with the default limits.
+	LimitPolicy `yaml:",inline"`
+	// Methods contains per method limit overrides. Keys are either a service (e.g., package.Service) or a method
+	// (e.g., package.Service/Method).
+	Methods map[string]LimitPolicy `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// HonorRetryInfo delays the calls after receiving an error with a RetryInfo detail until the delay requested
+	// by the server expires.
+	HonorRetryInfo bool `json:"honorRetryInfo,omitempty" yaml:"honorRetryInfo,omitempty"`
+}
+
+// Enabled returns true if any limit is set.
+func (rl RateLimitConfig) Enabled() bool {
+	if rl.LimitPolicy.Enabled() || rl.HonorRetryInfo {
+		return true
+	}
+	for _, policy := range rl.Methods {
+		if policy.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid checks if the limit options are valid.
+func (rl RateLimitConfig) IsValid() error {
+	if err := rl.LimitPolicy.IsValid(); err != nil {
+		return err
+	}
+	if err := checkMethodKeys(rl.Methods); err != nil {
+		return err
+	}
+	for name, policy := range rl.Methods {
+		if err := policy.IsValid(); err != nil {
+			return nerrors.NewInvalidArgumentErrorFrom(err, "invalid limits for %s", name)
+		}
+	}
+	return nil
+}
+
+// keyFor returns the key of the policy applied to a method, or an empty string for the default policy.
+func (rl RateLimitConfig) keyFor(method string) string {
+	key, _ := methodEntryKey(rl.Methods, method)
+	return key
+}
+
+// limiter enforces a LimitPolicy.
+type limiter struct {
+	sync.Mutex
+	// rate with the tokens added per second. Unlimited if zero.
+	rate float64
+	// burst with the maximum number of tokens.
+	burst float64
+	// tokens available.
+	tokens float64
+	// last time the tokens were refilled.
+	last time.Time
+	// pausedUntil with the time until which calls are delayed due to a server RetryInfo.
+	pausedUntil time.Time
+	// slots with the semaphore limiting the calls in flight. Unlimited if nil.
+	slots chan struct{}
+}
+
+// newLimiter creates a limiter for a policy.
+func newLimiter(policy LimitPolicy) *limiter {
+	result := &limiter{rate: policy.RequestsPerSecond, last: time.Now()}
+	if policy.RequestsPerSecond > 0 {
+		result.burst = float64(policy.Burst)
+		if result.burst == 0 {
+			result.burst = math.Max(1, math.Ceil(policy.RequestsPerSecond))
+		}
+		result.tokens = result.burst
+	}
+	if policy.MaxInFlight > 0 {
+		result.slots = make(chan struct{}, policy.MaxInFlight)
+	}
+	return result
+}
+
+// reserve takes a token if available, returning the time to wait otherwise.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate == 0 {
+		return 0
+	}
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// acquire waits until the call is allowed by the rate and concurrency limits, returning the function that releases
+// the concurrency slot.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	for {
+		wait := l.reserve(time.Now())
+		if wait == 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+		})
+	}, nil
+}
+
+// pause delays the next calls until the given time.
+func (l *limiter) pause(until time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// rateLimiter selects the limiter of each method.
+type rateLimiter struct {
+	config   RateLimitConfig
+	limiters map[string]*limiter
+}
+
+// newRateLimiter creates the limiters of a configuration.
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	limiters := map[string]*limiter{"": newLimiter(config.LimitPolicy)}
+	for key, policy := range config.Methods {
+		limiters[key] = newLimiter(policy)
+	}
+	return &rateLimiter{config: config, limiters: limiters}
+}
+
+// limiterFor returns the limiter of a method.
+func (rl *rateLimiter) limiterFor(method string) *limiter {
+	return rl.limiters[rl.config.keyFor(method)]
+}
+
+// observe pauses the limiter if the error contains a RetryInfo and the configuration honors it.
+func (rl *rateLimiter) observe(l *limiter, method string, err error) {
+	if err == nil || !rl.config.HonorRetryInfo {
+		return
+	}
+	if delay, found := retryInfoDelay(err); found {
+		log.Debug().Str("method", method).Dur("delay", delay).Msg("server requested to delay the calls")
+		l.pause(time.Now().Add(delay))
+	}
+}
+
+// retryInfoDelay returns the delay requested by the server in a RetryInfo error detail.
+func retryInfoDelay(err error) (time.Duration, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok && retryInfo.GetRetryDelay() != nil {
+			return retryInfo.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// RateLimitUnaryClientInterceptor returns a client interceptor that enforces the rate and concurrency limits of
+// the configuration. The limits are not shared with other interceptors; connections created with GetConnection
+// share them between the unary and stream calls.
+func RateLimitUnaryClientInterceptor(config RateLimitConfig) grpc.UnaryClientInterceptor {
+	return newRateLimiter(config).unaryInterceptor()
+}
+
+// RateLimitStreamClientInterceptor returns a client interceptor that enforces the rate and concurrency limits of
+// the configuration on streams. The concurrency slot is held until the stream finishes.
+func RateLimitStreamClientInterceptor(config RateLimitConfig) grpc.StreamClientInterceptor {
+	return newRateLimiter(config).streamInterceptor()
+}
+
+// unaryInterceptor returns a unary client interceptor that enforces the limits.
+func (rl *rateLimiter) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		l := rl.limiterFor(method)
+		release, err := l.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		rl.observe(l, method, err)
+		return err
+	}
+}
+
+// streamInterceptor returns a stream client interceptor that enforces the limits.
+func (rl *rateLimiter) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		l := rl.limiterFor(method)
+		release, err := l.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			release()
+			rl.observe(l, method, err)
+			return nil, err
+		}
+		// The stream context is done when the stream finishes, even if the messages are not consumed.
+		go func() {
+			<-stream.Context().Done()
+			release()
+		}()
+		return &observedStream{ClientStream: stream, desc: desc, method: method, start: time.Now(), onFinish: func(method string, err error, _ time.Duration) {
+			release()
+			rl.observe(l, method, err)
+		}}, nil
+	}
+}
@@ -0,0 +1,137 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var _ = ginkgo.Describe("Rate limiting", func() {
+
+	succeed := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		return nil
+	}
+
+	ginkgo.It("should refill the token bucket at the configured rate", func() {
+		l := newLimiter(LimitPolicy{RequestsPerSecond: 10, Burst: 2})
+		now := l.last
+		gomega.Expect(l.reserve(now)).To(gomega.BeZero())
+		gomega.Expect(l.reserve(now)).To(gomega.BeZero())
+		gomega.Expect(l.reserve(now)).To(gomega.Equal(100 * time.Millisecond))
+		gomega.Expect(l.reserve(now.Add(100 * time.Millisecond))).To(gomega.BeZero())
+	})
+
+	ginkgo.It("should select the limits of each method", func() {
+		config := RateLimitConfig{Methods: map[string]LimitPolicy{
+			"catalog.Catalog":        {MaxInFlight: 1},
+			"catalog.Catalog/Upload": {MaxInFlight: 2},
+		}}
+		gomega.Expect(config.IsValid()).To(gomega.Succeed())
+		gomega.Expect(config.keyFor("/catalog.Catalog/Upload")).To(gomega.Equal("catalog.Catalog/Upload"))
+		gomega.Expect(config.keyFor("/catalog.Catalog/List")).To(gomega.Equal("catalog.Catalog"))
+		gomega.Expect(config.keyFor("/users.Users/List")).To(gomega.Equal(""))
+	})
+
+	ginkgo.It("should select the limits of methods written with a leading slash", func() {
+		config := RateLimitConfig{Methods: map[string]LimitPolicy{"/catalog.Catalog/Upload": {MaxInFlight: 2}}}
+		gomega.Expect(config.IsValid()).To(gomega.Succeed())
+		gomega.Expect(config.keyFor("/catalog.Catalog/Upload")).To(gomega.Equal("/catalog.Catalog/Upload"))
+		config.Methods["catalog.Catalog/Upload"] = LimitPolicy{MaxInFlight: 1}
+		gomega.Expect(config.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject invalid limits", func() {
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7060, RateLimit: RateLimitConfig{
+			LimitPolicy: LimitPolicy{Burst: 2},
+			Methods:     map[string]LimitPolicy{"catalog.Catalog": {MaxInFlight: -1}},
+		}}
+		err := cfg.IsValid()
+		gomega.Expect(err).ToNot(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("rateLimit"))
+	})
+
+	ginkgo.It("should limit the calls in flight", func() {
+		interceptor := RateLimitUnaryClientInterceptor(RateLimitConfig{LimitPolicy: LimitPolicy{MaxInFlight: 1}})
+		started := make(chan struct{})
+		finish := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- interceptor(context.Background(), "/test.Service/Slow", nil, nil, nil,
+				func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+					close(started)
+					<-finish
+					return nil
+				})
+		}()
+		gomega.Eventually(started).Should(gomega.BeClosed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := interceptor(ctx, "/test.Service/Fast", nil, nil, nil, succeed)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.DeadlineExceeded))
+
+		close(finish)
+		gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+		gomega.Expect(interceptor(context.Background(), "/test.Service/Fast", nil, nil, nil, succeed)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should delay the calls as requested by the server", func() {
+		interceptor := RateLimitUnaryClientInterceptor(RateLimitConfig{HonorRetryInfo: true})
+		exhausted, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(200 * time.Millisecond),
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		err = interceptor(context.Background(), "/test.Service/Method", nil, nil, nil,
+			func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				return exhausted.Err()
+			})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.ResourceExhausted))
+
+		start := time.Now()
+		gomega.Expect(interceptor(context.Background(), "/test.Service/Method", nil, nil, nil, succeed)).To(gomega.Succeed())
+		gomega.Expect(time.Since(start)).To(gomega.BeNumerically(">=", 150*time.Millisecond))
+	})
+
+	ginkgo.It("should apply the limits configured in the connection", func() {
+		server, dialer := startBufconnServer(health.NewServer())
+		defer server.Stop()
+		cfg := &Config{ServerAddress: "bufnet", ServerPort: 443, RateLimit: RateLimitConfig{LimitPolicy: LimitPolicy{RequestsPerSecond: 20, Burst: 1, MaxInFlight: 1}}}
+		conn, err := GetConnection(cfg, dialer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+
+		client := grpc_health_v1.NewHealthClient(conn)
+		start := time.Now()
+		for call := 0; call < 3; call++ {
+			_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+			gomega.Expect(err).To(gomega.Succeed())
+		}
+		gomega.Expect(time.Since(start)).To(gomega.BeNumerically(">=", 90*time.Millisecond))
+	})
+})
@@ -0,0 +1,231 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog"
+)
+
+// RedactTag with the name of the struct tag that marks a field as sensitive. Sensitive fields are never printed,
+// a fingerprint of their content is shown instead.
+const RedactTag = "redact"
+
+// fingerprintSize with the number of bytes of the SHA-256 hash shown in the fingerprints.
+const fingerprintSize = 8
+
+// Fingerprint returns a short identifier of a sensitive value that allows comparing it without disclosing it.
+func Fingerprint(value string) string {
+	if value == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(hash[:fingerprintSize])
+}
+
+// durationType with the reflected type of time.Duration.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// redactedFields returns the fields of a structure indexed by their JSON name with the sensitive ones replaced
+// by their fingerprint. Nested values are represented as described in redactedValue.
+func redactedFields(value interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		return result
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldValue := v.Field(i)
+		if field.Anonymous && name == "" && fieldValue.Kind() == reflect.Struct {
+			for key, inner := range redactedFields(fieldValue.Interface()) {
+				result[key] = inner
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if field.Tag.Get(RedactTag) != "" {
+			result[name] = Fingerprint(fieldValue.String())
+		} else {
+			result[name] = redactedValue(fieldValue)
+		}
+	}
+	return result
+}
+
+// redactedValue returns the representation of a value with the sensitive fields of the structures redacted, also
+// when they are nested in pointers, maps, or slices. Durations and other fmt.Stringer values without exported fields
+// are represented in their textual form.
+func redactedValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactedValue(v.Elem())
+	case reflect.Struct:
+		if stringer, ok := v.Interface().(fmt.Stringer); ok && !hasExportedFields(v.Type()) {
+			return stringer.String()
+		}
+		return redactedFields(v.Interface())
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = redactedValue(iter.Value())
+		}
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			result[i] = redactedValue(v.Index(i))
+		}
+		return result
+	}
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return v.Interface()
+}
+
+// hasExportedFields returns true if the structure type has any exported field.
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalRedactedObject adds the redacted fields of a structure to a log event.
+func marshalRedactedObject(e *zerolog.Event, value interface{}) {
+	fields := redactedFields(value)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.Interface(key, fields[key])
+	}
+}
+
+// marshalRedactedJSON returns the JSON representation of the redacted fields of a structure.
+func marshalRedactedJSON(value interface{}) ([]byte, error) {
+	result, err := json.MarshalIndent(redactedFields(value), "", "  ")
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "cannot marshal redacted representation")
+	}
+	return result, nil
+}
+
+// redactedString returns the compact JSON representation of the redacted fields of a structure.
+func redactedString(value interface{}) string {
+	result, err := json.Marshal(redactedFields(value))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(result)
+}
+
+// RedactedFields returns all the configuration fields indexed by their JSON name, replacing the sensitive ones with
+// their fingerprint.
+func (cc *Config) RedactedFields() map[string]interface{} {
+	return redactedFields(cc)
+}
+
+// RedactedJSON returns the JSON representation of the configuration with the sensitive fields redacted. It is
+// intended for commands that show the configuration to the user.
+func (cc *Config) RedactedJSON() ([]byte, error) {
+	return marshalRedactedJSON(cc)
+}
+
+// String returns the representation of the configuration with the sensitive fields redacted.
+func (cc Config) String() string {
+	return redactedString(cc)
+}
+
+// GoString returns the representation of the configuration used by the %#v verb with the sensitive fields redacted.
+func (cc Config) GoString() string {
+	return redactedString(cc)
+}
+
+// MarshalZerologObject adds the configuration fields to a log event with the sensitive fields redacted.
+func (cc Config) MarshalZerologObject(e *zerolog.Event) {
+	marshalRedactedObject(e, cc)
+}
+
+// RedactedFields returns all the profile fields indexed by their JSON name, replacing the sensitive ones with
+// their fingerprint.
+func (p *Profile) RedactedFields() map[string]interface{} {
+	return redactedFields(p)
+}
+
+// RedactedJSON returns the JSON representation of the profile with the sensitive fields redacted.
+func (p *Profile) RedactedJSON() ([]byte, error) {
+	return marshalRedactedJSON(p)
+}
+
+// String returns the representation of the profile with the sensitive fields redacted.
+func (p Profile) String() string {
+	return redactedString(p)
+}
+
+// GoString returns the representation of the profile used by the %#v verb with the sensitive fields redacted.
+func (p Profile) GoString() string {
+	return redactedString(p)
+}
+
+// MarshalZerologObject adds the profile fields to a log event with the sensitive fields redacted.
+func (p Profile) MarshalZerologObject(e *zerolog.Event) {
+	marshalRedactedObject(e, p)
+}
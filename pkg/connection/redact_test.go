@@ -0,0 +1,106 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+var _ = ginkgo.Describe("Redacted representations", func() {
+
+	const secretCA = "c2VjcmV0IGNhIGNvbnRlbnQ="
+	const secretToken = "secret-token"
+
+	var profile *Profile
+
+	ginkgo.BeforeEach(func() {
+		profile = &Profile{
+			Config: Config{
+				Name:           "playground",
+				ServerAddress:  "playground.napptive.dev",
+				ServerPort:     443,
+				ClientCA:       secretCA,
+				ConnectTimeout: 5 * time.Second,
+			},
+			Credentials: Credentials{Token: secretToken},
+		}
+	})
+
+	ginkgo.It("should log every field masking the sensitive ones", func() {
+		buffer := &bytes.Buffer{}
+		logger := zerolog.New(buffer)
+		logger.Info().EmbedObject(&profile.Config).Msg("test")
+
+		entry := make(map[string]interface{})
+		gomega.Expect(json.Unmarshal(buffer.Bytes(), &entry)).To(gomega.Succeed())
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("serverAddress", "playground.napptive.dev"))
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("clientCA", Fingerprint(secretCA)))
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("connectTimeout", "5s"))
+		gomega.Expect(entry).To(gomega.HaveKey("skipCertValidation"))
+		gomega.Expect(buffer.String()).ToNot(gomega.ContainSubstring(secretCA))
+	})
+
+	ginkgo.It("should export the profile as JSON with the same rules", func() {
+		content, err := profile.RedactedJSON()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(content)).ToNot(gomega.ContainSubstring(secretCA))
+		gomega.Expect(string(content)).ToNot(gomega.ContainSubstring(secretToken))
+
+		view := make(map[string]interface{})
+		gomega.Expect(json.Unmarshal(content, &view)).To(gomega.Succeed())
+		gomega.Expect(view).To(gomega.HaveKeyWithValue("name", "playground"))
+		gomega.Expect(view["credentials"]).To(gomega.HaveKeyWithValue("token", Fingerprint(secretToken)))
+		gomega.Expect(view["credentials"]).To(gomega.HaveKeyWithValue("refreshToken", ""))
+	})
+
+	ginkgo.It("should not disclose secrets in the string representation", func() {
+		gomega.Expect(profile.String()).ToNot(gomega.ContainSubstring(secretToken))
+		gomega.Expect(profile.Config.String()).ToNot(gomega.ContainSubstring(secretCA))
+		gomega.Expect(profile.Config.String()).To(gomega.ContainSubstring("playground.napptive.dev"))
+	})
+
+	ginkgo.It("should redact configurations printed as values", func() {
+		profile.Proxy = ProxyConfig{URL: "http://proxy.internal:3128", Username: "user", Password: "proxy-password"}
+		for _, printed := range []string{fmt.Sprint(profile.Config), fmt.Sprintf("%v", *profile), fmt.Sprint(&profile.Config),
+			fmt.Sprintf("%#v", profile.Config), fmt.Sprintf("%#v", profile), fmt.Sprintf("%#v", []Profile{*profile})} {
+			gomega.Expect(printed).ToNot(gomega.ContainSubstring("proxy-password"))
+			gomega.Expect(printed).ToNot(gomega.ContainSubstring(secretCA))
+		}
+	})
+
+	ginkgo.It("should represent nested values in their textual form", func() {
+		profile.Timeouts = TimeoutConfig{Methods: map[string]time.Duration{"catalog.Catalog": 2 * time.Second}}
+		profile.Retry = RetryConfig{Methods: map[string]RetryPolicy{"catalog.Catalog": {MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond}}}
+		fields := profile.Config.RedactedFields()
+		gomega.Expect(fields["timeouts"]).To(gomega.HaveKeyWithValue("methods", gomega.HaveKeyWithValue("catalog.Catalog", "2s")))
+		retry, ok := fields["retry"].(map[string]interface{})
+		gomega.Expect(ok).To(gomega.BeTrue())
+		gomega.Expect(retry["methods"]).To(gomega.HaveKeyWithValue("catalog.Catalog", gomega.HaveKeyWithValue("initialBackoff", "100ms")))
+
+		list := &Profiles{Profiles: []Profile{*profile}}
+		gomega.Expect(redactedString(list)).ToNot(gomega.ContainSubstring(secretToken))
+		gomega.Expect(redactedString(list)).To(gomega.ContainSubstring(Fingerprint(secretToken)))
+	})
+
+})
@@ -0,0 +1,384 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxRetryAttempts with the maximum number of attempts supported by gRPC retry policies.
+const MaxRetryAttempts = 5
+
+// DefaultInitialBackoff with the backoff used before the first retry if none is specified.
+const DefaultInitialBackoff = 100 * time.Millisecond
+
+// DefaultMaxBackoff with the upper limit of the backoff if none is specified.
+const DefaultMaxBackoff = 5 * time.Second
+
+// DefaultBackoffMultiplier with the multiplier applied to the backoff after each attempt if none is specified.
+const DefaultBackoffMultiplier = 2.0
+
+// DefaultRetryableCodes contains the status codes that are retried if none are specified.
+var DefaultRetryableCodes = []string{"UNAVAILABLE"}
+
+// RetryPolicy defines how the failed calls of a method are retried.
+type RetryPolicy struct {
+	// MaxAttempts with the maximum number of attempts including the original call. Retries are disabled if lower than 2.
+	MaxAttempts int `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	// InitialBackoff with the maximum delay before the first retry.
+	InitialBackoff time.Duration `json:"initialBackoff,omitempty" yaml:"initialBackoff,omitempty"`
+	// MaxBackoff with the upper limit of the delay between retries.
+	MaxBackoff time.Duration `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
+	// BackoffMultiplier with the factor applied to the backoff after each attempt.
+	BackoffMultiplier float64 `json:"backoffMultiplier,omitempty" yaml:"backoffMultiplier,omitempty"`
+	// RetryableCodes contains the gRPC status codes (e.g., UNAVAILABLE) that trigger a retry.
+	RetryableCodes []string `json:"retryableCodes,omitempty" yaml:"retryableCodes,omitempty"`
+}
+
+// Enabled returns true if the policy allows retrying a call.
+func (rp RetryPolicy) Enabled() bool {
+	return rp.MaxAttempts > 1
+}
+
+// IsValid checks if the policy options are valid.
+func (rp RetryPolicy) IsValid() error {
+	if rp.MaxAttempts < 0 || rp.MaxAttempts > MaxRetryAttempts {
+		return nerrors.NewInvalidArgumentError("retry maxAttempts must be between 0 and %d", MaxRetryAttempts)
+	}
+	if rp.InitialBackoff < 0 || rp.MaxBackoff < 0 {
+		return nerrors.NewInvalidArgumentError("retry backoff cannot be negative")
+	}
+	if rp.BackoffMultiplier < 0 {
+		return nerrors.NewInvalidArgumentError("retry backoffMultiplier cannot be negative")
+	}
+	if _, err := parseCodes(rp.RetryableCodes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the policy where the missing values are taken from the given base policy
+// or the package defaults.
+func (rp RetryPolicy) withDefaults(base RetryPolicy) RetryPolicy {
+	result := rp
+	if result.MaxAttempts == 0 {
+		result.MaxAttempts = base.MaxAttempts
+	}
+	if result.InitialBackoff == 0 {
+		result.InitialBackoff = base.InitialBackoff
+		if result.InitialBackoff == 0 {
+			result.InitialBackoff = DefaultInitialBackoff
+		}
+	}
+	if result.MaxBackoff == 0 {
+		result.MaxBackoff = base.MaxBackoff
+		if result.MaxBackoff == 0 {
+			result.MaxBackoff = DefaultMaxBackoff
+		}
+	}
+	if result.BackoffMultiplier == 0 {
+		result.BackoffMultiplier = base.BackoffMultiplier
+		if result.BackoffMultiplier == 0 {
+			result.BackoffMultiplier = DefaultBackoffMultiplier
+		}
+	}
+	if len(result.RetryableCodes) == 0 {
+		result.RetryableCodes = base.RetryableCodes
+		if len(result.RetryableCodes) == 0 {
+			result.RetryableCodes = DefaultRetryableCodes
+		}
+	}
+	return result
+}
+
+// backoff returns the delay before the given retry, starting at 1, following the gRPC retry design with
+// full jitter.
+func (rp RetryPolicy) backoff(retry int) time.Duration {
+	limit := float64(rp.InitialBackoff) * math.Pow(rp.BackoffMultiplier, float64(retry-1))
+	if limit > float64(rp.MaxBackoff) {
+		limit = float64(rp.MaxBackoff)
+	}
+	return time.Duration(rand.Float64() * limit)
+}
+
+// RetryConfig contains the retry options of a connection.
+type RetryConfig struct {
+	// RetryPolicy with the default policy applied to all methods.
+	RetryPolicy `yaml:",inline"`
+	// Methods contains per method policy overrides. Keys are either a service (e.g., package.Service) or a
+	// method (e.g., package.Service/Method). Missing values are taken from the default policy.
+	Methods map[string]RetryPolicy `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// IdempotentMethods contains the methods that are retried by a client interceptor instead of relying
+	// on the service config. This guarantees the retries even when the resolver provides its own service
+	// config, and must only be used for methods that are safe to execute more than once.
+	IdempotentMethods []string `json:"idempotentMethods,omitempty" yaml:"idempotentMethods,omitempty"`
+}
+
+// Enabled returns true if any of the policies allows retrying a call.
+func (rc RetryConfig) Enabled() bool {
+	if rc.RetryPolicy.Enabled() {
+		return true
+	}
+	for _, policy := range rc.Methods {
+		if policy.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid checks if the retry options are valid.
+func (rc RetryConfig) IsValid() error {
+	if err := rc.RetryPolicy.IsValid(); err != nil {
+		return err
+	}
+	if err := checkMethodKeys(rc.Methods); err != nil {
+		return err
+	}
+	for name, policy := range rc.Methods {
+		if err := policy.IsValid(); err != nil {
+			return nerrors.NewInvalidArgumentErrorFrom(err, "invalid retry policy for %s", name)
+		}
+	}
+	for _, name := range rc.IdempotentMethods {
+		if _, _, err := splitMethodName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PolicyFor returns the effective policy for a given method. The method may be expressed as package.Service/Method
+// or using the full method name received by interceptors (e.g., /package.Service/Method).
+func (rc RetryConfig) PolicyFor(method string) RetryPolicy {
+	if key, exists := methodEntryKey(rc.Methods, method); exists {
+		return rc.Methods[key].withDefaults(rc.RetryPolicy)
+	}
+	return rc.RetryPolicy.withDefaults(RetryPolicy{})
+}
+
+// isIdempotent checks if a method must be retried by the client interceptor.
+func (rc RetryConfig) isIdempotent(method string) bool {
+	service, name, err := splitMethodName(method)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range rc.IdempotentMethods {
+		candidateService, candidateName, err := splitMethodName(candidate)
+		if err != nil || candidateService != service {
+			continue
+		}
+		if candidateName == "" || candidateName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonMethodName is the JSON representation of a method name in a gRPC service config.
+type jsonMethodName struct {
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+// jsonRetryPolicy is the JSON representation of a retry policy in a gRPC service config.
+type jsonRetryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// jsonMethodConfig is the JSON representation of a method config entry in a gRPC service config.
+type jsonMethodConfig struct {
+	Name        []jsonMethodName `json:"name"`
+	RetryPolicy *jsonRetryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// toJSON transforms the policy into its service config representation. The policy must have the defaults applied.
+func (rp RetryPolicy) toJSON() *jsonRetryPolicy {
+	if !rp.Enabled() {
+		return nil
+	}
+	retryableCodes := make([]string, 0, len(rp.RetryableCodes))
+	for _, code := range rp.RetryableCodes {
+		retryableCodes = append(retryableCodes, strings.ToUpper(code))
+	}
+	return &jsonRetryPolicy{
+		MaxAttempts:          rp.MaxAttempts,
+		InitialBackoff:       formatDuration(rp.InitialBackoff),
+		MaxBackoff:           formatDuration(rp.MaxBackoff),
+		BackoffMultiplier:    rp.BackoffMultiplier,
+		RetryableStatusCodes: retryableCodes,
+	}
+}
+
+// methodConfigs returns the method config entries of the gRPC service config. The unretried methods are excluded from
+// the default retry policy.
+func (rc RetryConfig) methodConfigs(unretried []string) ([]jsonMethodConfig, error) {
+	result := make([]jsonMethodConfig, 0)
+	if rc.RetryPolicy.Enabled() {
+		result = append(result, jsonMethodConfig{
+			Name:        []jsonMethodName{{}},
+			RetryPolicy: rc.RetryPolicy.withDefaults(RetryPolicy{}).toJSON(),
+		})
+	}
+	// Each name may only appear once in the service config, so entries are indexed by name.
+	entries := make(map[jsonMethodName]int)
+	add := func(name string, policy *jsonRetryPolicy) error {
+		service, method, err := splitMethodName(name)
+		if err != nil {
+			return err
+		}
+		key := jsonMethodName{Service: service, Method: method}
+		if index, exists := entries[key]; exists {
+			result[index].RetryPolicy = policy
+			return nil
+		}
+		entries[key] = len(result)
+		result = append(result, jsonMethodConfig{Name: []jsonMethodName{key}, RetryPolicy: policy})
+		return nil
+	}
+	for name, policy := range rc.Methods {
+		retryPolicy := policy.withDefaults(rc.RetryPolicy).toJSON()
+		if rc.isIdempotent(name) {
+			// Methods retried by the interceptor must not be retried by the channel as well.
+			retryPolicy = nil
+		}
+		if err := add(name, retryPolicy); err != nil {
+			return nil, err
+		}
+	}
+	// Methods retried by the interceptor must not be retried by the channel as well.
+	for _, name := range append(append([]string{}, rc.IdempotentMethods...), unretried...) {
+		if err := add(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RetryUnaryClientInterceptor returns a client interceptor that retries the calls to the idempotent methods of the
+// configuration following their retry policy. Other methods are invoked once.
+func RetryUnaryClientInterceptor(rc RetryConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !rc.isIdempotent(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		policy := rc.PolicyFor(method)
+		retryableCodes, err := parseCodes(policy.RetryableCodes)
+		if err != nil {
+			return err
+		}
+		attempt := 1
+		for {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= policy.MaxAttempts || !retryableCodes[status.Code(err)] {
+				return err
+			}
+			delay := policy.backoff(attempt)
+			log.Debug().Str("method", method).Int("attempt", attempt).Dur("backoff", delay).Err(err).Msg("retrying call")
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			attempt++
+		}
+	}
+}
+
+// splitMethodName extracts the service and method from a name with the form package.Service/Method,
+// package.Service, or /package.Service/Method.
+func splitMethodName(name string) (string, string, error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	if service == "" || strings.Contains(method, "/") {
+		return "", "", nerrors.NewInvalidArgumentError("invalid method name %q, expecting package.Service/Method", name)
+	}
+	return service, method, nil
+}
+
+// methodEntryKey returns the key of the entry that applies to a method: the entry of the method itself or, if
+// missing, the entry of its service. Keys may use any of the forms accepted by splitMethodName.
+func methodEntryKey[V any](entries map[string]V, method string) (string, bool) {
+	service, name, err := splitMethodName(method)
+	if err != nil {
+		return "", false
+	}
+	serviceKey, serviceFound := "", false
+	for key := range entries {
+		keyService, keyName, err := splitMethodName(key)
+		if err != nil || keyService != service {
+			continue
+		}
+		if keyName != "" && keyName == name {
+			return key, true
+		}
+		if keyName == "" {
+			serviceKey, serviceFound = key, true
+		}
+	}
+	return serviceKey, serviceFound
+}
+
+// checkMethodKeys checks that the keys of a per method configuration are valid method names, and that no method or
+// service is configured twice using different forms (e.g., with and without the leading slash).
+func checkMethodKeys[V any](entries map[string]V) error {
+	found := make(map[string]string, len(entries))
+	for key := range entries {
+		service, name, err := splitMethodName(key)
+		if err != nil {
+			return err
+		}
+		normalized := service + "/" + name
+		if previous, exists := found[normalized]; exists {
+			return nerrors.NewInvalidArgumentError("%q and %q refer to the same method", previous, key)
+		}
+		found[normalized] = key
+	}
+	return nil
+}
+
+// parseCodes transforms a list of status code names (e.g., UNAVAILABLE) into a set of gRPC codes.
+func parseCodes(names []string) (map[codes.Code]bool, error) {
+	result := make(map[codes.Code]bool, len(names))
+	for _, name := range names {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+			return nil, nerrors.NewInvalidArgumentError("invalid status code %q", name)
+		}
+		result[code] = true
+	}
+	return result, nil
+}
+
+// formatDuration returns the string representation of a duration as expected by the gRPC service config.
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,194 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// flakyHealthServer is a health server that fails a given number of times before answering.
+type flakyHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	sync.Mutex
+	failures int
+	calls    int
+}
+
+// Check fails with UNAVAILABLE until the configured number of failures is reached.
+func (fs *flakyHealthServer) Check(_ context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.calls++
+	if fs.calls <= fs.failures {
+		return nil, status.Error(codes.Unavailable, "server not ready")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// Calls returns the number of received calls.
+func (fs *flakyHealthServer) Calls() int {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.calls
+}
+
+// startBufconnServer launches an in-process gRPC server with the given health server and returns the
+// dial option required to connect to it.
+func startBufconnServer(healthServer grpc_health_v1.HealthServer) (*grpc.Server, grpc.DialOption) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	})
+	return server, dialer
+}
+
+var _ = ginkgo.Describe("Retry policies", func() {
+
+	var healthServer *flakyHealthServer
+	var server *grpc.Server
+	var dialer grpc.DialOption
+
+	ginkgo.BeforeEach(func() {
+		healthServer = &flakyHealthServer{failures: 2}
+		server, dialer = startBufconnServer(healthServer)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Stop()
+	})
+
+	check := func(cfg *Config) error {
+		conn, err := GetNonTLSConnection(cfg, "bufnet", dialer)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	ginkgo.It("should fail without a retry policy", func() {
+		err := check(&Config{})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should retry using the service config", func() {
+		cfg := &Config{Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}}}
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should stop after the maximum number of attempts", func() {
+		healthServer.failures = 5
+		cfg := &Config{Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}}
+		err := check(cfg)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("should apply the per method overrides", func() {
+		cfg := &Config{Retry: RetryConfig{
+			RetryPolicy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+			Methods:     map[string]RetryPolicy{"grpc.health.v1.Health/Check": {MaxAttempts: 4}},
+		}}
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should apply the overrides of methods written with a leading slash", func() {
+		cfg := &Config{Retry: RetryConfig{
+			RetryPolicy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+			Methods:     map[string]RetryPolicy{"/grpc.health.v1.Health/Check": {MaxAttempts: 4}},
+		}}
+		gomega.Expect(cfg.Retry.IsValid()).To(gomega.Succeed())
+		gomega.Expect(cfg.Retry.PolicyFor("/grpc.health.v1.Health/Check").MaxAttempts).To(gomega.Equal(4))
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should reject methods configured twice", func() {
+		rc := RetryConfig{Methods: map[string]RetryPolicy{"pkg.Service/Get": {MaxAttempts: 2}, "/pkg.Service/Get": {MaxAttempts: 3}}}
+		gomega.Expect(rc.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should not retry in the channel the methods retried by the interceptor", func() {
+		healthServer.failures = 10
+		cfg := &Config{Retry: RetryConfig{
+			Methods:           map[string]RetryPolicy{"grpc.health.v1.Health/Check": {MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+			IdempotentMethods: []string{"grpc.health.v1.Health"},
+		}}
+		err := check(cfg)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Unavailable))
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should retry idempotent methods with the interceptor", func() {
+		cfg := &Config{Retry: RetryConfig{
+			RetryPolicy:       RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			IdempotentMethods: []string{"grpc.health.v1.Health"},
+		}}
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should accept idempotent methods with a method policy", func() {
+		cfg := &Config{Retry: RetryConfig{
+			Methods:           map[string]RetryPolicy{"grpc.health.v1.Health/Check": {MaxAttempts: 3, InitialBackoff: 10 * time.Microsecond}},
+			IdempotentMethods: []string{"grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Check"},
+		}}
+		gomega.Expect(cfg.Retry.IsValid()).To(gomega.Succeed())
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should accept small backoffs in the service config", func() {
+		gomega.Expect(formatDuration(10 * time.Microsecond)).To(gomega.Equal("0.00001s"))
+		gomega.Expect(formatDuration(1500 * time.Millisecond)).To(gomega.Equal("1.5s"))
+		cfg := &Config{Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Microsecond}}}
+		gomega.Expect(check(cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Calls()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should reject invalid policies", func() {
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7000}
+		cfg.Retry.MaxAttempts = 10
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Retry.MaxAttempts = 3
+		cfg.Retry.RetryableCodes = []string{"NOT_A_CODE"}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Retry.RetryableCodes = []string{"unavailable", "RESOURCE_EXHAUSTED"}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+	})
+
+})
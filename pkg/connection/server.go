@@ -0,0 +1,303 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/napptive/go-utils/pkg/validation"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+// DefaultShutdownTimeout with the default time to wait for the ongoing calls when the server is stopped.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ServerConfig contains the configuration elements of a gRPC server.
+type ServerConfig struct {
+	// Name of the server as user information.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// ListenAddress with the address:port the server listens on (e.g., :7060).
+	ListenAddress string `json:"listenAddress,omitempty" yaml:"listenAddress,omitempty"`
+	// TLSCertificate with the certificate chain of the server, given as raw PEM, base64 encoded PEM, or the path of a
+	// file. TLS is disabled if empty.
+	TLSCertificate string `json:"tlsCertificate,omitempty" yaml:"tlsCertificate,omitempty"`
+	// TLSKey with the private key of the server certificate, given as raw PEM, base64 encoded PEM, or the path of a file.
+	TLSKey string `json:"tlsKey,omitempty" yaml:"tlsKey,omitempty" redact:"true"`
+	// ClientCA with the CA used to verify the client certificates, given as raw PEM, base64 encoded PEM, or a file path.
+	ClientCA string `json:"clientCA,omitempty" yaml:"clientCA,omitempty" redact:"true"`
+	// RequireClientCert rejects the clients that do not present a certificate signed by the ClientCA.
+	RequireClientCert bool `json:"requireClientCert,omitempty" yaml:"requireClientCert,omitempty"`
+	// KeepaliveMinTime with the minimum time between client pings. Clients pinging more frequently are disconnected.
+	KeepaliveMinTime time.Duration `json:"keepaliveMinTime,omitempty" yaml:"keepaliveMinTime,omitempty"`
+	// KeepalivePermitWithoutStream allows client pings when there are no active calls.
+	KeepalivePermitWithoutStream bool `json:"keepalivePermitWithoutStream,omitempty" yaml:"keepalivePermitWithoutStream,omitempty"`
+	// MaxRecvMsgSize with the maximum size in bytes of the received messages. gRPC default if zero.
+	MaxRecvMsgSize int `json:"maxRecvMsgSize,omitempty" yaml:"maxRecvMsgSize,omitempty"`
+	// MaxSendMsgSize with the maximum size in bytes of the sent messages. gRPC default if zero.
+	MaxSendMsgSize int `json:"maxSendMsgSize,omitempty" yaml:"maxSendMsgSize,omitempty"`
+	// MinClientVersion with the minimum client version accepted by the server. Clients reporting a lower version
+	// through the VersionHeader are rejected. All versions are accepted if empty.
+	MinClientVersion string `json:"minClientVersion,omitempty" yaml:"minClientVersion,omitempty"`
+	// RecommendedClientVersion with the client version recommended by the server. It is reported to the clients in
+	// the response trailers together with the MinClientVersion.
+	RecommendedClientVersion string `json:"recommendedClientVersion,omitempty" yaml:"recommendedClientVersion,omitempty"`
+	// DisableReflection disables the registration of the server reflection service.
+	DisableReflection bool `json:"disableReflection,omitempty" yaml:"disableReflection,omitempty"`
+	// ShutdownTimeout with the time to wait for the ongoing calls on shutdown. DefaultShutdownTimeout if zero.
+	ShutdownTimeout time.Duration `json:"shutdownTimeout,omitempty" yaml:"shutdownTimeout,omitempty"`
+}
+
+// IsValid checks if the server configuration options are valid.
+func (sc *ServerConfig) IsValid() error {
+	violations := validation.NewViolations()
+	if err := validation.CheckNotEmpty(sc.ListenAddress, "listenAddress"); err != nil {
+		violations.Check("listenAddress", err)
+	} else if _, port, err := net.SplitHostPort(sc.ListenAddress); err != nil || port == "" {
+		violations.Add("listenAddress", "must have the form address:port")
+	}
+	if (sc.TLSCertificate == "") != (sc.TLSKey == "") {
+		violations.Add("tlsCertificate", "tlsCertificate and tlsKey must be set together")
+	} else if sc.TLSCertificate != "" {
+		if _, err := sc.getCertificate(); err != nil {
+			violations.Check("tlsCertificate", err)
+		}
+	}
+	if sc.ClientCA != "" {
+		if sc.TLSCertificate == "" {
+			violations.Add("clientCA", "TLS is required to verify client certificates")
+		}
+		if _, err := parseClientCA(sc.ClientCA); err != nil {
+			violations.Check("clientCA", err)
+		}
+	} else if sc.RequireClientCert {
+		violations.Add("requireClientCert", "clientCA is required to verify client certificates")
+	}
+	if sc.KeepaliveMinTime < 0 {
+		violations.Add("keepaliveMinTime", "cannot be negative")
+	}
+	if sc.MaxRecvMsgSize < 0 {
+		violations.Add("maxRecvMsgSize", "cannot be negative")
+	}
+	if sc.MaxSendMsgSize < 0 {
+		violations.Add("maxSendMsgSize", "cannot be negative")
+	}
+	if sc.MinClientVersion != "" {
+		if _, err := ParseVersion(sc.MinClientVersion); err != nil {
+			violations.Check("minClientVersion", err)
+		}
+	}
+	if sc.RecommendedClientVersion != "" {
+		recommended, err := ParseVersion(sc.RecommendedClientVersion)
+		if err != nil {
+			violations.Check("recommendedClientVersion", err)
+		} else if minVersion, err := ParseVersion(sc.MinClientVersion); err == nil && recommended.LessThan(*minVersion) {
+			violations.Add("recommendedClientVersion", "cannot be lower than minClientVersion")
+		}
+	}
+	if sc.ShutdownTimeout < 0 {
+		violations.Add("shutdownTimeout", "cannot be negative")
+	}
+	return violations.ToError("invalid server configuration")
+}
+
+// Print the configuration using the application logger. Sensitive fields are redacted.
+func (sc *ServerConfig) Print() {
+	log.Info().Fields(redactedFields(sc)).Msg("Server options")
+}
+
+// getCertificate decodes the server certificate and key.
+func (sc *ServerConfig) getCertificate() (tls.Certificate, error) {
+	certificate, _, err := loadPEM(sc.TLSCertificate, "server certificate")
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, _, err := loadPEM(sc.TLSKey, "server key")
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	result, err := tls.X509KeyPair(certificate, key)
+	if err != nil {
+		return tls.Certificate{}, nerrors.NewInvalidArgumentErrorFrom(err, "invalid server certificate or key")
+	}
+	return result, nil
+}
+
+// getServerOptions returns the server options derived from the configuration.
+func (sc *ServerConfig) getServerOptions() ([]grpc.ServerOption, error) {
+	result := make([]grpc.ServerOption, 0)
+	if sc.TLSCertificate != "" {
+		certificate, err := sc.getCertificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+		if sc.ClientCA != "" {
+			certificates, err := parseClientCA(sc.ClientCA)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			for _, ca := range certificates {
+				pool.AddCert(ca)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			if sc.RequireClientCert {
+				tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		result = append(result, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if sc.KeepaliveMinTime > 0 || sc.KeepalivePermitWithoutStream {
+		result = append(result, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             sc.KeepaliveMinTime,
+			PermitWithoutStream: sc.KeepalivePermitWithoutStream,
+		}))
+	}
+	if sc.MaxRecvMsgSize > 0 {
+		result = append(result, grpc.MaxRecvMsgSize(sc.MaxRecvMsgSize))
+	}
+	if sc.MaxSendMsgSize > 0 {
+		result = append(result, grpc.MaxSendMsgSize(sc.MaxSendMsgSize))
+	}
+	minClientVersion, err := parseOptionalVersion(sc.MinClientVersion)
+	if err != nil {
+		return nil, err
+	}
+	recommendedClientVersion, err := parseOptionalVersion(sc.RecommendedClientVersion)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result,
+		grpc.ChainUnaryInterceptor(AccessLogUnaryServerInterceptor(), RecoveryUnaryServerInterceptor(),
+			VersionTrailerUnaryServerInterceptor(minClientVersion, recommendedClientVersion),
+			ClientInfoUnaryServerInterceptor(minClientVersion)),
+		grpc.ChainStreamInterceptor(AccessLogStreamServerInterceptor(), RecoveryStreamServerInterceptor(),
+			VersionTrailerStreamServerInterceptor(minClientVersion, recommendedClientVersion),
+			ClientInfoStreamServerInterceptor(minClientVersion)),
+	)
+	return result, nil
+}
+
+// parseOptionalVersion parses a version, returning nil if it is empty.
+func parseOptionalVersion(version string) (*Version, error) {
+	if version == "" {
+		return nil, nil
+	}
+	return ParseVersion(version)
+}
+
+// Server is a gRPC server with the health and reflection services registered, and the standard interceptors
+// installed.
+type Server struct {
+	// Server with the underlying gRPC server where the application services are registered.
+	*grpc.Server
+	// Health with the health service used to report the status of the application services.
+	Health *health.Server
+	// cfg with the server configuration.
+	cfg *ServerConfig
+}
+
+// NewServer creates a Server with a given configuration. Additional server options, such as extra interceptors,
+// are applied after the ones derived from the configuration.
+func NewServer(cfg *ServerConfig, opts ...grpc.ServerOption) (*Server, error) {
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+	serverOptions, err := cfg.getServerOptions()
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(append(serverOptions, opts...)...)
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	if !cfg.DisableReflection {
+		reflection.Register(server)
+	}
+	return &Server{Server: server, Health: healthServer, cfg: cfg}, nil
+}
+
+// Run listens on the configured address and serves the requests until an interrupt signal is received.
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", s.cfg.ListenAddress)
+	if err != nil {
+		return nerrors.NewUnavailableErrorFrom(err, "cannot listen on %s", s.cfg.ListenAddress)
+	}
+	return s.ServeUntilSignal(listener)
+}
+
+// ServeUntilSignal serves the requests received on the listener until an interrupt signal is received, and then
+// shuts down the server gracefully.
+func (s *Server) ServeUntilSignal(listener net.Listener) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, InterruptSignals...)
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("name", s.cfg.Name).Str("address", listener.Addr().String()).Msg("gRPC server listening")
+		serveErr <- s.Server.Serve(listener)
+	}()
+
+	select {
+	case sig := <-signals:
+		log.Info().Str("signal", sig.String()).Msg("shutting down gRPC server")
+		s.Shutdown()
+		return <-serveErr
+	case err := <-serveErr:
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "gRPC server failed")
+		}
+		return nil
+	}
+}
+
+// Shutdown marks all services as not serving and stops the server, waiting for the ongoing calls up to the
+// configured shutdown timeout.
+func (s *Server) Shutdown() {
+	s.Health.Shutdown()
+	timeout := s.cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn().Dur("timeout", timeout).Msg("graceful shutdown timed out, stopping the server")
+		s.Server.Stop()
+	}
+}
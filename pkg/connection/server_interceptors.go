@@ -0,0 +1,91 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryUnaryServerInterceptor returns a server interceptor that transforms a panic in a handler into an
+// Internal error.
+func RecoveryUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoveredError(info.FullMethod, recovered)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamServerInterceptor returns a server interceptor that transforms a panic in a stream handler into an
+// Internal error.
+func RecoveryStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoveredError(info.FullMethod, recovered)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recoveredError logs a recovered panic and returns the error sent to the client.
+func recoveredError(method string, recovered interface{}) error {
+	log.Error().Str("method", method).Interface("panic", recovered).Str("stack", string(debug.Stack())).Msg("panic handling call")
+	return nerrors.NewInternalError("internal error processing %s", method).ToGRPC()
+}
+
+// AccessLogUnaryServerInterceptor returns a server interceptor that logs each call with its duration and status code.
+func AccessLogUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logAccess(ctx, info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// AccessLogStreamServerInterceptor returns a server interceptor that logs each stream with its duration and
+// status code once it finishes.
+func AccessLogStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logAccess(ss.Context(), info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+// logAccess logs the result of a call.
+func logAccess(ctx context.Context, method string, err error, duration time.Duration) {
+	event := logCallEvent(err).Str("method", method).Str("code", status.Code(err).String()).Dur("duration", duration)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event = event.Str("peer", p.Addr.String())
+	}
+	event.Msg("access")
+}
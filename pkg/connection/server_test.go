@@ -0,0 +1,151 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+var _ = ginkgo.Describe("gRPC server", func() {
+
+	ginkgo.It("should validate the configuration", func() {
+		gomega.Expect((&ServerConfig{ListenAddress: ":7060"}).IsValid()).To(gomega.Succeed())
+		gomega.Expect((&ServerConfig{}).IsValid()).ToNot(gomega.Succeed())
+
+		err := (&ServerConfig{ListenAddress: "localhost", TLSKey: "a2V5", RequireClientCert: true}).IsValid()
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.InvalidArgument))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("listenAddress"))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("tlsCertificate"))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("requireClientCert"))
+	})
+
+	ginkgo.It("should transform handler panics into internal errors", func() {
+		interceptor := RecoveryUnaryServerInterceptor()
+		info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Panic"}
+		_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("unexpected")
+		})
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.Internal))
+	})
+
+	ginkgo.Context("serving requests", func() {
+
+		ginkgo.BeforeEach(func() {
+			InterruptSignals = []os.Signal{syscall.SIGUSR1}
+		})
+
+		ginkgo.AfterEach(func() {
+			InterruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+		})
+
+		ginkgo.It("should serve TLS with certificates given as PEM or files", func() {
+			ca := newTestCertificate(nil, true)
+			leaf := newTestCertificate(&ca, false)
+			keyDER, err := x509.MarshalECPrivateKey(leaf.PrivateKey.(*ecdsa.PrivateKey))
+			gomega.Expect(err).To(gomega.Succeed())
+			dir, err := os.MkdirTemp("", "server")
+			gomega.Expect(err).To(gomega.Succeed())
+			defer os.RemoveAll(dir)
+			certificatePath := filepath.Join(dir, "tls.crt")
+			gomega.Expect(os.WriteFile(certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Leaf.Raw}), 0600)).To(gomega.Succeed())
+
+			cfg := &ServerConfig{
+				ListenAddress:  "127.0.0.1:0",
+				TLSCertificate: certificatePath,
+				TLSKey:         string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+			}
+			gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+			server, err := NewServer(cfg)
+			gomega.Expect(err).To(gomega.Succeed())
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			gomega.Expect(err).To(gomega.Succeed())
+			go func(server *Server, listener net.Listener) {
+				_ = server.Serve(listener)
+			}(server, listener)
+			defer server.Stop()
+
+			conn, err := GetConnection(&Config{
+				ServerAddress: "127.0.0.1",
+				ServerPort:    listener.Addr().(*net.TCPAddr).Port,
+				UseTLS:        true,
+				ClientCA:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Leaf.Raw})),
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should register health and reflection and stop on signals", func() {
+			server, err := NewServer(&ServerConfig{Name: "test", ListenAddress: "127.0.0.1:0", ShutdownTimeout: time.Second})
+			gomega.Expect(err).To(gomega.Succeed())
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			gomega.Expect(err).To(gomega.Succeed())
+			finished := make(chan error, 1)
+			go func() {
+				finished <- server.ServeUntilSignal(listener)
+			}()
+
+			conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(response.Status).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+
+			stream, err := grpc_reflection_v1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(stream.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
+				MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{},
+			})).To(gomega.Succeed())
+			reflectionResponse, err := stream.Recv()
+			gomega.Expect(err).To(gomega.Succeed())
+			services := make([]string, 0)
+			for _, service := range reflectionResponse.GetListServicesResponse().GetService() {
+				services = append(services, service.Name)
+			}
+			gomega.Expect(services).To(gomega.ContainElement("grpc.health.v1.Health"))
+			gomega.Expect(stream.CloseSend()).To(gomega.Succeed())
+
+			gomega.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(gomega.Succeed())
+			gomega.Eventually(finished, 5*time.Second).Should(gomega.Receive(gomega.BeNil()))
+		})
+	})
+})
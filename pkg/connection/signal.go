@@ -0,0 +1,79 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ForceExitCode with the exit code used when the user sends a second interrupt signal.
+const ForceExitCode = 130
+
+// InterruptSignals contains the list of signals that cancel an ongoing operation.
+var InterruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// forceExit terminates the process. It is defined as a variable so that it can be replaced in tests.
+var forceExit = os.Exit
+
+// CancelHook is a function called when an operation is canceled due to an interrupt signal.
+type CancelHook func(sig os.Signal)
+
+// NewSignalContext returns a context that is canceled when the process receives one of the InterruptSignals. The
+// onCancel hook, if set, is called after the context is canceled. A second signal received before the returned
+// cancel function is called forces the exit of the process.
+func NewSignalContext(parent context.Context, onCancel CancelHook) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, InterruptSignals...)
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+		cancel()
+	}
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Debug().Str("signal", sig.String()).Msg("canceling operation")
+			cancel()
+			if onCancel != nil {
+				onCancel(sig)
+			}
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Debug().Str("signal", sig.String()).Msg("forcing exit")
+			forceExit(ForceExitCode)
+		case <-done:
+		}
+	}()
+
+	return ctx, stop
+}
@@ -0,0 +1,86 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Signal aware contexts", func() {
+
+	var exitCode chan int
+
+	// The test suite uses SIGUSR1 as ginkgo already handles SIGINT and SIGTERM.
+	ginkgo.BeforeEach(func() {
+		InterruptSignals = []os.Signal{syscall.SIGUSR1}
+		exitCode = make(chan int, 1)
+		forceExit = func(code int) {
+			exitCode <- code
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		forceExit = os.Exit
+		InterruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	})
+
+	ginkgo.It("should cancel the context on the first signal", func() {
+		received := make(chan os.Signal, 1)
+		ctx, cancel := NewSignalContext(context.Background(), func(sig os.Signal) {
+			received <- sig
+		})
+		defer cancel()
+
+		gomega.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(gomega.Succeed())
+		gomega.Eventually(ctx.Done(), time.Second).Should(gomega.BeClosed())
+		gomega.Eventually(received, time.Second).Should(gomega.Receive(gomega.Equal(syscall.SIGUSR1)))
+		gomega.Consistently(exitCode, 100*time.Millisecond).ShouldNot(gomega.Receive())
+	})
+
+	ginkgo.It("should force the exit on the second signal", func() {
+		ctx, cancel := NewSignalContext(context.Background(), nil)
+		defer cancel()
+
+		gomega.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(gomega.Succeed())
+		gomega.Eventually(ctx.Done(), time.Second).Should(gomega.BeClosed())
+		gomega.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(gomega.Succeed())
+		gomega.Eventually(exitCode, time.Second).Should(gomega.Receive(gomega.Equal(ForceExitCode)))
+	})
+
+	ginkgo.It("should wrap the contexts of the helper", func() {
+		received := make(chan os.Signal, 1)
+		helper := NewInterruptibleContextHelper("v1.0.0", "test", nil)
+		helper.OnCancel = func(sig os.Signal) {
+			received <- sig
+		}
+		ctx, cancel := helper.GetContext()
+		defer cancel()
+		_, hasDeadline := ctx.Deadline()
+		gomega.Expect(hasDeadline).To(gomega.BeTrue())
+
+		gomega.Expect(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)).To(gomega.Succeed())
+		gomega.Eventually(ctx.Done(), time.Second).Should(gomega.BeClosed())
+		gomega.Eventually(received, time.Second).Should(gomega.Receive())
+	})
+
+})
@@ -0,0 +1,120 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dnsScheme with the scheme of the gRPC dns resolver.
+const dnsScheme = "dns"
+
+// unixScheme with the scheme of the gRPC unix domain socket resolver.
+const unixScheme = "unix"
+
+// targetSchemeRegex detects addresses that are gRPC target URIs (e.g., dns:///host, unix:path).
+var targetSchemeRegex = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):(//)?`)
+
+// parseTarget checks if the address is a gRPC target URI returning its scheme and endpoint.
+func parseTarget(address string) (string, string, bool) {
+	matches := targetSchemeRegex.FindStringSubmatch(address)
+	if matches == nil {
+		return "", "", false
+	}
+	scheme := strings.ToLower(matches[1])
+	// An IPv6 literal or a host:port pair is not a target URI.
+	if matches[2] == "" && scheme != unixScheme && scheme != "unix-abstract" {
+		return "", "", false
+	}
+	endpoint := strings.TrimPrefix(address, matches[0])
+	if matches[2] != "" {
+		// Remove the authority of the URI.
+		if index := strings.Index(endpoint, "/"); index >= 0 {
+			endpoint = endpoint[index+1:]
+		}
+	}
+	return scheme, endpoint, true
+}
+
+// trimBrackets removes the brackets surrounding an IPv6 literal.
+func trimBrackets(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// GetHostPort returns the host:port string of the server. IPv6 literals are enclosed in brackets.
+func (cc *Config) GetHostPort() string {
+	if scheme, endpoint, isURI := parseTarget(cc.ServerAddress); isURI {
+		if scheme == dnsScheme {
+			return cc.addDefaultPort(endpoint)
+		}
+		return endpoint
+	}
+	return net.JoinHostPort(trimBrackets(cc.ServerAddress), strconv.Itoa(cc.ServerPort))
+}
+
+// addDefaultPort adds the ServerPort to an endpoint that does not specify one.
+func (cc *Config) addDefaultPort(endpoint string) string {
+	if cc.ServerPort == 0 {
+		return endpoint
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+	return net.JoinHostPort(trimBrackets(endpoint), strconv.Itoa(cc.ServerPort))
+}
+
+// GetEffectiveAddress returns the gRPC target used to connect with the server. Plain addresses are returned as
+// host:port, or as a dns target if a load balancing policy is set and the server is not reached through a proxy, as
+// the proxy must receive the host name instead of the resolved IPs. Target URIs are returned as they are, adding the
+// ServerPort to dns targets without a port.
+func (cc *Config) GetEffectiveAddress() string {
+	if scheme, endpoint, isURI := parseTarget(cc.ServerAddress); isURI {
+		if scheme == dnsScheme {
+			prefix := strings.TrimSuffix(cc.ServerAddress, endpoint)
+			return prefix + cc.addDefaultPort(endpoint)
+		}
+		return cc.ServerAddress
+	}
+	hostPort := cc.GetHostPort()
+	if cc.LoadBalancingPolicy != "" && !cc.usesProxy(hostPort) {
+		return dnsScheme + ":///" + hostPort
+	}
+	return hostPort
+}
+
+// usesProxy checks if the connections with an address are established through the proxy.
+func (cc *Config) usesProxy(address string) bool {
+	proxyURL, err := cc.Proxy.ProxyFor(&url.URL{Scheme: "https", Host: address})
+	// Invalid proxy configurations are reported by IsValid.
+	return err == nil && proxyURL != nil
+}
+
+// getUnixSocketPath returns the path of the unix domain socket if the server address is a unix target.
+func (cc *Config) getUnixSocketPath() (string, bool) {
+	scheme, endpoint, isURI := parseTarget(cc.ServerAddress)
+	if !isURI || scheme != unixScheme {
+		return "", false
+	}
+	if strings.HasPrefix(cc.ServerAddress[len(unixScheme)+1:], "//") {
+		return "/" + endpoint, true
+	}
+	return endpoint, true
+}
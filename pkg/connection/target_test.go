@@ -0,0 +1,119 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = ginkgo.Describe("Target construction", func() {
+
+	table.DescribeTable("effective address",
+		func(cfg Config, expected string) {
+			gomega.Expect(cfg.GetEffectiveAddress()).To(gomega.Equal(expected))
+		},
+		table.Entry("hostname", Config{ServerAddress: "playground.napptive.dev", ServerPort: 443}, "playground.napptive.dev:443"),
+		table.Entry("IPv4", Config{ServerAddress: "10.0.0.1", ServerPort: 7060}, "10.0.0.1:7060"),
+		table.Entry("IPv6", Config{ServerAddress: "::1", ServerPort: 7060}, "[::1]:7060"),
+		table.Entry("bracketed IPv6", Config{ServerAddress: "[fe80::1]", ServerPort: 7060}, "[fe80::1]:7060"),
+		table.Entry("round robin", Config{ServerAddress: "api.napptive.dev", ServerPort: 443, LoadBalancingPolicy: "round_robin"}, "dns:///api.napptive.dev:443"),
+		table.Entry("round robin through a proxy", Config{ServerAddress: "api.napptive.dev", ServerPort: 443, LoadBalancingPolicy: "round_robin",
+			Proxy: ProxyConfig{URL: "http://proxy.internal:3128"}}, "api.napptive.dev:443"),
+		table.Entry("round robin excluded from the proxy", Config{ServerAddress: "api.napptive.dev", ServerPort: 443, LoadBalancingPolicy: "round_robin",
+			Proxy: ProxyConfig{URL: "http://proxy.internal:3128", NoProxy: ".napptive.dev"}}, "dns:///api.napptive.dev:443"),
+		table.Entry("dns target without port", Config{ServerAddress: "dns:///api.napptive.dev", ServerPort: 443}, "dns:///api.napptive.dev:443"),
+		table.Entry("dns target with port", Config{ServerAddress: "dns://8.8.8.8/api.napptive.dev:8443", ServerPort: 443}, "dns://8.8.8.8/api.napptive.dev:8443"),
+		table.Entry("unix socket", Config{ServerAddress: "unix:///var/run/sidecar.sock"}, "unix:///var/run/sidecar.sock"),
+		table.Entry("passthrough target", Config{ServerAddress: "passthrough:///catalog:7060", ServerPort: 443}, "passthrough:///catalog:7060"),
+	)
+
+	ginkgo.It("should validate target URIs", func() {
+		gomega.Expect((&Config{ServerAddress: "unix:///var/run/sidecar.sock"}).IsValid()).To(gomega.Succeed())
+		gomega.Expect((&Config{ServerAddress: "unknown:///catalog"}).IsValid()).ToNot(gomega.Succeed())
+		gomega.Expect((&Config{ServerAddress: "xds:///catalog"}).IsValid()).ToNot(gomega.Succeed())
+		gomega.Expect((&Config{ServerAddress: "::1", ServerPort: 7060}).IsValid()).To(gomega.Succeed())
+		gomega.Expect((&Config{ServerAddress: "localhost", ServerPort: 7060, LoadBalancingPolicy: "unknown"}).IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should include the load balancing policy in the service config", func() {
+		cfg := &Config{LoadBalancingPolicy: "round_robin"}
+		gomega.Expect(cfg.GetServiceConfig()).To(gomega.MatchJSON(`{"loadBalancingConfig": [{"round_robin": {}}]}`))
+	})
+
+	ginkgo.Context("with a real server", func() {
+
+		var dir string
+		var server *grpc.Server
+
+		startServer := func(network string, address string) net.Addr {
+			listener, err := net.Listen(network, address)
+			gomega.Expect(err).To(gomega.Succeed())
+			server = grpc.NewServer()
+			grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			return listener.Addr()
+		}
+
+		check := func(cfg *Config) error {
+			gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+			conn, err := GetConnection(cfg)
+			gomega.Expect(err).To(gomega.Succeed())
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return WaitForReady(ctx, conn, "")
+		}
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "target")
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Stop()
+			gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should connect through a unix domain socket", func() {
+			path := filepath.Join(dir, "sidecar.sock")
+			startServer("unix", path)
+			gomega.Expect(check(&Config{ServerAddress: "unix://" + path})).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should connect with round robin load balancing", func() {
+			address := startServer("tcp", "127.0.0.1:0").(*net.TCPAddr)
+			cfg := &Config{ServerAddress: "127.0.0.1", ServerPort: address.Port, LoadBalancingPolicy: "round_robin"}
+			gomega.Expect(check(cfg)).To(gomega.Succeed())
+		})
+
+	})
+
+})
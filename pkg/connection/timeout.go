@@ -0,0 +1,102 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"google.golang.org/grpc"
+)
+
+// TimeoutConfig contains the timeouts applied to the calls whose context has no deadline.
+type TimeoutConfig struct {
+	// Default with the timeout applied to the methods without an override. Disabled if zero.
+	Default time.Duration `json:"default,omitempty" yaml:"default,omitempty"`
+	// Methods contains per method timeouts. Keys are either a service (e.g., package.Service) or a method
+	// (e.g., package.Service/Method).
+	Methods map[string]time.Duration `json:"methods,omitempty" yaml:"methods,omitempty"`
+}
+
+// Enabled returns true if any timeout is set.
+func (tc TimeoutConfig) Enabled() bool {
+	return tc.Default > 0 || len(tc.Methods) > 0
+}
+
+// IsValid checks if the timeout options are valid.
+func (tc TimeoutConfig) IsValid() error {
+	if tc.Default < 0 {
+		return nerrors.NewInvalidArgumentError("default timeout cannot be negative")
+	}
+	if err := checkMethodKeys(tc.Methods); err != nil {
+		return err
+	}
+	for name, timeout := range tc.Methods {
+		if timeout <= 0 {
+			return nerrors.NewInvalidArgumentError("timeout for %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// TimeoutFor returns the timeout of a method, or zero if it has no timeout. The method may be expressed as
+// package.Service/Method or using the full method name received by interceptors (e.g., /package.Service/Method).
+func (tc TimeoutConfig) TimeoutFor(method string) time.Duration {
+	if key, exists := methodEntryKey(tc.Methods, method); exists {
+		return tc.Methods[key]
+	}
+	return tc.Default
+}
+
+// withTimeout returns a context with the timeout of the method if the context has no deadline.
+func (tc TimeoutConfig) withTimeout(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		return ctx, func() {}
+	}
+	timeout := tc.TimeoutFor(method)
+	if timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// TimeoutUnaryClientInterceptor returns a client interceptor that applies the configured timeouts to the calls
+// whose context has no deadline. Deadlines set by the caller are always preserved.
+func TimeoutUnaryClientInterceptor(config TimeoutConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := config.withTimeout(ctx, method)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// TimeoutStreamClientInterceptor returns a client interceptor that applies the configured timeouts to the streams
+// whose context has no deadline. The timeout covers the whole stream.
+func TimeoutStreamClientInterceptor(config TimeoutConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, cancel := config.withTimeout(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &observedStream{ClientStream: stream, desc: desc, method: method, start: time.Now(), onFinish: func(string, error, time.Duration) {
+			cancel()
+		}}, nil
+	}
+}
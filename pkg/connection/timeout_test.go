@@ -0,0 +1,146 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// slowHealthServer is a health server that delays the answer of the first calls until their context is done.
+type slowHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	sync.Mutex
+	slowCalls int
+	calls     int
+	deadlines []time.Duration
+}
+
+// Check blocks the first slowCalls calls until the context is done and answers the rest immediately.
+func (ss *slowHealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	ss.Lock()
+	ss.calls++
+	slow := ss.calls <= ss.slowCalls
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		ss.deadlines = append(ss.deadlines, time.Until(deadline))
+	}
+	ss.Unlock()
+	if slow {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// Calls returns the number of received calls.
+func (ss *slowHealthServer) Calls() int {
+	ss.Lock()
+	defer ss.Unlock()
+	return ss.calls
+}
+
+// Deadlines returns the remaining time of the deadlines received by the server.
+func (ss *slowHealthServer) Deadlines() []time.Duration {
+	ss.Lock()
+	defer ss.Unlock()
+	return append([]time.Duration{}, ss.deadlines...)
+}
+
+var _ = ginkgo.Describe("Per method timeouts", func() {
+
+	var healthServer *slowHealthServer
+	var server *grpc.Server
+	var dialer grpc.DialOption
+
+	ginkgo.BeforeEach(func() {
+		healthServer = &slowHealthServer{}
+		server, dialer = startBufconnServer(healthServer)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Stop()
+	})
+
+	check := func(ctx context.Context, cfg *Config) error {
+		conn, err := GetNonTLSConnection(cfg, "bufnet", dialer)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	ginkgo.It("should apply the method timeout to calls without deadline", func() {
+		healthServer.slowCalls = 1
+		cfg := &Config{Timeouts: TimeoutConfig{
+			Default: time.Minute,
+			Methods: map[string]time.Duration{"grpc.health.v1.Health/Check": 50 * time.Millisecond},
+		}}
+		err := check(context.Background(), cfg)
+		gomega.Expect(status.Code(err)).To(gomega.Equal(codes.DeadlineExceeded))
+		gomega.Expect(healthServer.Deadlines()).To(gomega.HaveLen(1))
+		gomega.Expect(healthServer.Deadlines()[0]).To(gomega.BeNumerically("<=", 50*time.Millisecond))
+	})
+
+	ginkgo.It("should preserve the deadline of the caller", func() {
+		cfg := &Config{Timeouts: TimeoutConfig{Default: 50 * time.Millisecond}}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		gomega.Expect(check(ctx, cfg)).To(gomega.Succeed())
+		gomega.Expect(healthServer.Deadlines()).To(gomega.HaveLen(1))
+		gomega.Expect(healthServer.Deadlines()[0]).To(gomega.BeNumerically(">", time.Second))
+	})
+
+	ginkgo.It("should resolve the timeout of a method", func() {
+		cfg := TimeoutConfig{
+			Default: time.Minute,
+			Methods: map[string]time.Duration{"pkg.Service": time.Second, "pkg.Service/Slow": time.Hour},
+		}
+		gomega.Expect(cfg.TimeoutFor("/pkg.Service/Slow")).To(gomega.Equal(time.Hour))
+		gomega.Expect(cfg.TimeoutFor("/pkg.Service/Fast")).To(gomega.Equal(time.Second))
+		gomega.Expect(cfg.TimeoutFor("/pkg.Other/Fast")).To(gomega.Equal(time.Minute))
+
+		cfg.Methods = map[string]time.Duration{"/pkg.Service/Slow": time.Hour}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+		gomega.Expect(cfg.TimeoutFor("/pkg.Service/Slow")).To(gomega.Equal(time.Hour))
+		cfg.Methods["pkg.Service/Slow"] = time.Second
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should not set a deadline on contexts without timeout", func() {
+		ctx, cancel := NewContextHelper("v1.0.0", "test", nil).GetContextWithoutTimeout()
+		defer cancel()
+		_, hasDeadline := ctx.Deadline()
+		gomega.Expect(hasDeadline).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject invalid timeouts", func() {
+		cfg := &Config{ServerAddress: "localhost", ServerPort: 7000}
+		cfg.Timeouts.Methods = map[string]time.Duration{"pkg.Service": -time.Second}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+		cfg.Timeouts.Methods = map[string]time.Duration{"pkg.Service": time.Second}
+		gomega.Expect(cfg.IsValid()).To(gomega.Succeed())
+	})
+
+})
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// Version with a semantic version (https://semver.org). Build metadata is ignored.
+type Version struct {
+	// Major version number.
+	Major int
+	// Minor version number.
+	Minor int
+	// Patch version number.
+	Patch int
+	// PreRelease with the optional pre-release identifiers (e.g., rc.1).
+	PreRelease string
+}
+
+// ParseVersion parses a semantic version with an optional v prefix (e.g., v1.2.3-rc.1).
+func ParseVersion(version string) (*Version, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	value, _, _ = strings.Cut(value, "+")
+	value, preRelease, hasPreRelease := strings.Cut(value, "-")
+	if hasPreRelease && preRelease == "" {
+		return nil, nerrors.NewInvalidArgumentError("invalid version %q: empty pre-release", version)
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return nil, nerrors.NewInvalidArgumentError("invalid version %q: expecting major.minor.patch", version)
+	}
+	numbers := make([]int, len(parts))
+	for index, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, nerrors.NewInvalidArgumentError("invalid version %q: %q is not a valid number", version, part)
+		}
+		numbers[index] = number
+	}
+	return &Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], PreRelease: preRelease}, nil
+}
+
+// String returns the version with the v prefix.
+func (v Version) String() string {
+	result := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		result = result + "-" + v.PreRelease
+	}
+	return result
+}
+
+// Compare returns -1, 0 or 1 if the version is lower than, equal to or greater than other, following the
+// semantic versioning precedence rules.
+func (v Version) Compare(other Version) int {
+	if result := compareInt(v.Major, other.Major); result != 0 {
+		return result
+	}
+	if result := compareInt(v.Minor, other.Minor); result != 0 {
+		return result
+	}
+	if result := compareInt(v.Patch, other.Patch); result != 0 {
+		return result
+	}
+	return comparePreRelease(v.PreRelease, other.PreRelease)
+}
+
+// LessThan checks if the version has lower precedence than other.
+func (v Version) LessThan(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// compareInt compares two integers.
+func compareInt(a int, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease compares two pre-release strings. A version without pre-release has higher precedence.
+func comparePreRelease(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	left := strings.Split(a, ".")
+	right := strings.Split(b, ".")
+	for index := 0; index < len(left) && index < len(right); index++ {
+		leftNumber, leftErr := strconv.Atoi(left[index])
+		rightNumber, rightErr := strconv.Atoi(right[index])
+		var result int
+		switch {
+		case leftErr == nil && rightErr == nil:
+			result = compareInt(leftNumber, rightNumber)
+		case leftErr == nil:
+			// Numeric identifiers have lower precedence than alphanumeric ones.
+			result = -1
+		case rightErr == nil:
+			result = 1
+		default:
+			result = strings.Compare(left[index], right[index])
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return compareInt(len(left), len(right))
+}
@@ -0,0 +1,208 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MinVersionHeader with the trailer key used by servers to report the minimum supported client version.
+const MinVersionHeader = "min-version"
+
+// RecommendedVersionHeader with the trailer key used by servers to report the recommended client version.
+const RecommendedVersionHeader = "recommended-version"
+
+// UpgradeWarning with the warning shown when the server recommends a newer client version.
+type UpgradeWarning struct {
+	// CurrentVersion with the version of the client.
+	CurrentVersion string `json:"currentVersion"`
+	// RecommendedVersion with the version recommended by the server.
+	RecommendedVersion string `json:"recommendedVersion"`
+	// Message to show to the user.
+	Message string `json:"message"`
+}
+
+// versionTrailer returns the trailer announcing the supported client versions.
+func versionTrailer(minVersion *Version, recommendedVersion *Version) metadata.MD {
+	md := metadata.MD{}
+	if minVersion != nil {
+		md.Set(MinVersionHeader, minVersion.String())
+	}
+	if recommendedVersion != nil {
+		md.Set(RecommendedVersionHeader, recommendedVersion.String())
+	}
+	return md
+}
+
+// VersionTrailerUnaryServerInterceptor returns a server interceptor that reports the minimum and recommended client
+// versions in the response trailers. Nil versions are not reported.
+func VersionTrailerUnaryServerInterceptor(minVersion *Version, recommendedVersion *Version) grpc.UnaryServerInterceptor {
+	trailer := versionTrailer(minVersion, recommendedVersion)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if trailer.Len() > 0 {
+			if err := grpc.SetTrailer(ctx, trailer); err != nil {
+				log.Debug().Err(err).Str("method", info.FullMethod).Msg("cannot set version trailer")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// VersionTrailerStreamServerInterceptor returns a server interceptor that reports the minimum and recommended client
+// versions in the stream trailers. Nil versions are not reported.
+func VersionTrailerStreamServerInterceptor(minVersion *Version, recommendedVersion *Version) grpc.StreamServerInterceptor {
+	trailer := versionTrailer(minVersion, recommendedVersion)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if trailer.Len() > 0 {
+			ss.SetTrailer(trailer)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// VersionChecker checks the client version against the versions reported by the server in the response trailers.
+// Failed calls return a FailedPrecondition error wrapping the original one when the client is below the minimum
+// version, while successful calls are never replaced as the server may have applied their changes. An upgrade warning
+// is shown once when the client is below the minimum or the recommended version and the call succeeds.
+type VersionChecker struct {
+	// Version of the client. Checks are skipped if it is not a valid semantic version.
+	Version string
+	// OnWarning is called with the upgrade warning. If not set, the warning is written on the standard error so that
+	// the command output is not altered.
+	OnWarning func(warning *UpgradeWarning)
+	// warnOnce guarantees that the upgrade warning is shown only once.
+	warnOnce sync.Once
+}
+
+// NewVersionChecker creates a VersionChecker for a given client version.
+func NewVersionChecker(version string) *VersionChecker {
+	return &VersionChecker{Version: version}
+}
+
+// DialOptions returns the dial options that install the unary and stream version check interceptors.
+func (vc *VersionChecker) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		WithUnaryInterceptors(vc.UnaryClientInterceptor()),
+		WithStreamInterceptors(vc.StreamClientInterceptor()),
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor that checks the versions reported in the response trailers.
+func (vc *VersionChecker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+		return vc.check(trailer, err)
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor that checks the versions reported in the trailers once
+// the stream finishes.
+func (vc *VersionChecker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &versionCheckedStream{ClientStream: stream, desc: desc, checker: vc}, nil
+	}
+}
+
+// check compares the client version with the versions in the trailer and returns the error of the call. If the call
+// failed and the client is below the minimum version, the error is wrapped in a FailedPrecondition one, otherwise a
+// warning is shown.
+func (vc *VersionChecker) check(trailer metadata.MD, callErr error) error {
+	current, err := ParseVersion(vc.Version)
+	if err != nil {
+		return callErr
+	}
+	if minVersion := trailerVersion(trailer, MinVersionHeader); minVersion != nil && current.LessThan(*minVersion) {
+		message := fmt.Sprintf("client version %s is no longer supported by the server, please upgrade to %s or later", current, minVersion)
+		if callErr != nil {
+			return nerrors.NewFailedPreconditionErrorFrom(callErr, "%s", message).ToGRPC()
+		}
+		vc.warnOnce.Do(func() {
+			vc.warn(&UpgradeWarning{CurrentVersion: current.String(), RecommendedVersion: minVersion.String(), Message: message})
+		})
+		return nil
+	}
+	if recommended := trailerVersion(trailer, RecommendedVersionHeader); recommended != nil && current.LessThan(*recommended) {
+		vc.warnOnce.Do(func() {
+			vc.warn(&UpgradeWarning{
+				CurrentVersion:     current.String(),
+				RecommendedVersion: recommended.String(),
+				Message:            "A new version " + recommended.String() + " is available, please upgrade from " + current.String(),
+			})
+		})
+	}
+	return callErr
+}
+
+// warn shows the upgrade warning using the OnWarning hook, or on the standard error if not set. The ResultPrinter is
+// not used as the warning would be mixed with the output of the command.
+func (vc *VersionChecker) warn(warning *UpgradeWarning) {
+	if vc.OnWarning != nil {
+		vc.OnWarning(warning)
+		return
+	}
+	fmt.Fprintln(os.Stderr, warning.Message)
+}
+
+// trailerVersion returns the version stored in a trailer key, or nil if missing or invalid.
+func trailerVersion(trailer metadata.MD, key string) *Version {
+	values := trailer.Get(key)
+	if len(values) == 0 {
+		return nil
+	}
+	version, err := ParseVersion(values[0])
+	if err != nil {
+		log.Debug().Str("key", key).Str("value", values[0]).Msg("ignoring invalid version in trailer")
+		return nil
+	}
+	return version
+}
+
+// versionCheckedStream wraps a client stream to check the trailers when the stream finishes.
+type versionCheckedStream struct {
+	grpc.ClientStream
+	desc    *grpc.StreamDesc
+	checker *VersionChecker
+}
+
+// RecvMsg receives a message and checks the trailers once the stream finishes. Streams finish on error or EOF, or
+// after the single response of the streams without server streaming.
+func (s *versionCheckedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil && s.desc.ServerStreams {
+		return nil
+	}
+	if err == io.EOF {
+		// EOF marks a successful stream, so the check can only show the upgrade warning.
+		_ = s.checker.check(s.ClientStream.Trailer(), nil)
+		return err
+	}
+	return s.checker.check(s.ClientStream.Trailer(), err)
+}
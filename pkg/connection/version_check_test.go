@@ -0,0 +1,201 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// finishedStream is a client stream whose RecvMsg returns a given error and trailer.
+type finishedStream struct {
+	grpc.ClientStream
+	err     error
+	trailer metadata.MD
+}
+
+// RecvMsg returns the configured error.
+func (fs *finishedStream) RecvMsg(interface{}) error {
+	return fs.err
+}
+
+// Trailer returns the configured trailer.
+func (fs *finishedStream) Trailer() metadata.MD {
+	return fs.trailer
+}
+
+// recordingPrinter is a ResultPrinter that stores the printed results.
+type recordingPrinter struct {
+	sync.Mutex
+	results []interface{}
+}
+
+// Print stores the result.
+func (rp *recordingPrinter) Print(result interface{}) error {
+	rp.Lock()
+	defer rp.Unlock()
+	rp.results = append(rp.results, result)
+	return nil
+}
+
+// PrintResultOrError stores the result or the error.
+func (rp *recordingPrinter) PrintResultOrError(result interface{}, err error) error {
+	if err != nil {
+		return rp.Print(err)
+	}
+	return rp.Print(result)
+}
+
+// Printed returns the stored results.
+func (rp *recordingPrinter) Printed() []interface{} {
+	rp.Lock()
+	defer rp.Unlock()
+	return append([]interface{}{}, rp.results...)
+}
+
+// warningRecorder stores the upgrade warnings shown by a VersionChecker.
+type warningRecorder struct {
+	sync.Mutex
+	warnings []*UpgradeWarning
+}
+
+// record stores the warning.
+func (wr *warningRecorder) record(warning *UpgradeWarning) {
+	wr.Lock()
+	defer wr.Unlock()
+	wr.warnings = append(wr.warnings, warning)
+}
+
+// Warnings returns the stored warnings.
+func (wr *warningRecorder) Warnings() []*UpgradeWarning {
+	wr.Lock()
+	defer wr.Unlock()
+	return append([]*UpgradeWarning{}, wr.warnings...)
+}
+
+var _ = ginkgo.Describe("Client version negotiation", func() {
+
+	var server *Server
+	var listener *bufconn.Listener
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		server, err = NewServer(&ServerConfig{ListenAddress: "127.0.0.1:0", MinClientVersion: "v1.2.0", RecommendedClientVersion: "v1.5.0"})
+		gomega.Expect(err).To(gomega.Succeed())
+		listener = bufconn.Listen(1024 * 1024)
+		go func(server *Server, listener *bufconn.Listener) {
+			_ = server.Serve(listener)
+		}(server, listener)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Stop()
+	})
+
+	check := func(version string, recorder *warningRecorder, calls int, service string) error {
+		checker := NewVersionChecker(version)
+		checker.OnWarning = recorder.record
+		opts := append(checker.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}))
+		conn, err := grpc.Dial("bufnet", opts...)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer conn.Close()
+		client := grpc_health_v1.NewHealthClient(conn)
+		for call := 0; call < calls; call++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ginkgo.It("should validate the announced versions", func() {
+		cfg := &ServerConfig{ListenAddress: ":7060", MinClientVersion: "v2.0.0", RecommendedClientVersion: "v1.0.0"}
+		gomega.Expect(cfg.IsValid()).ToNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should warn once when below the recommended version", func() {
+		recorder := &warningRecorder{}
+		gomega.Expect(check("v1.3.0", recorder, 3, "")).To(gomega.Succeed())
+		gomega.Expect(recorder.Warnings()).To(gomega.HaveLen(1))
+		warning := recorder.Warnings()[0]
+		gomega.Expect(warning.RecommendedVersion).To(gomega.Equal("v1.5.0"))
+		gomega.Expect(warning.CurrentVersion).To(gomega.Equal("v1.3.0"))
+	})
+
+	ginkgo.It("should not warn up to date clients", func() {
+		recorder := &warningRecorder{}
+		gomega.Expect(check("v1.5.0", recorder, 2, "")).To(gomega.Succeed())
+		gomega.Expect(recorder.Warnings()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should warn instead of failing successful calls below the minimum version", func() {
+		recorder := &warningRecorder{}
+		gomega.Expect(check("v1.0.0", recorder, 2, "")).To(gomega.Succeed())
+		gomega.Expect(recorder.Warnings()).To(gomega.HaveLen(1))
+		warning := recorder.Warnings()[0]
+		gomega.Expect(warning.RecommendedVersion).To(gomega.Equal("v1.2.0"))
+		gomega.Expect(warning.Message).To(gomega.ContainSubstring("please upgrade to v1.2.0"))
+	})
+
+	ginkgo.It("should fail when a call fails below the minimum version", func() {
+		recorder := &warningRecorder{}
+		err := check("v1.0.0", recorder, 1, "unknown")
+		extended := nerrors.FromGRPC(err)
+		gomega.Expect(extended.Code).To(gomega.Equal(nerrors.FailedPrecondition))
+		gomega.Expect(extended.Error()).To(gomega.ContainSubstring("please upgrade to v1.2.0"))
+		gomega.Expect(extended.Error()).To(gomega.ContainSubstring("unknown service"))
+		gomega.Expect(recorder.Warnings()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should preserve the result of finished streams", func() {
+		recorder := &warningRecorder{}
+		checker := NewVersionChecker("v1.0.0")
+		checker.OnWarning = recorder.record
+		trailer := metadata.Pairs(MinVersionHeader, "v1.2.0")
+		completed := &versionCheckedStream{ClientStream: &finishedStream{err: io.EOF, trailer: trailer}, desc: &grpc.StreamDesc{ServerStreams: true}, checker: checker}
+		gomega.Expect(completed.RecvMsg(nil)).To(gomega.Equal(io.EOF))
+		gomega.Expect(recorder.Warnings()).To(gomega.HaveLen(1))
+
+		unary := &versionCheckedStream{ClientStream: &finishedStream{trailer: trailer}, desc: &grpc.StreamDesc{ClientStreams: true}, checker: checker}
+		gomega.Expect(unary.RecvMsg(nil)).To(gomega.Succeed())
+
+		failed := &versionCheckedStream{ClientStream: &finishedStream{err: status.Error(codes.Internal, "stream broken"), trailer: trailer}, desc: &grpc.StreamDesc{ServerStreams: true}, checker: checker}
+		extended := nerrors.FromGRPC(failed.RecvMsg(nil))
+		gomega.Expect(extended.Code).To(gomega.Equal(nerrors.FailedPrecondition))
+		gomega.Expect(extended.Error()).To(gomega.ContainSubstring("stream broken"))
+	})
+})
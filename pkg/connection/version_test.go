@@ -0,0 +1,64 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Semantic versions", func() {
+
+	ginkgo.It("should parse versions with and without prefix", func() {
+		version, err := ParseVersion("v1.2.3-rc.1+build.5")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*version).To(gomega.Equal(Version{Major: 1, Minor: 2, Patch: 3, PreRelease: "rc.1"}))
+		gomega.Expect(version.String()).To(gomega.Equal("v1.2.3-rc.1"))
+
+		version, err = ParseVersion("0.10.0")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(version.String()).To(gomega.Equal("v0.10.0"))
+	})
+
+	ginkgo.It("should reject invalid versions", func() {
+		for _, invalid := range []string{"", "dev", "v1.2", "v1.2.x", "v1.2.3-", "v1.-2.3"} {
+			_, err := ParseVersion(invalid)
+			gomega.Expect(err).ToNot(gomega.Succeed(), invalid)
+		}
+	})
+
+	table.DescribeTable("precedence",
+		func(a string, b string, expected int) {
+			left, err := ParseVersion(a)
+			gomega.Expect(err).To(gomega.Succeed())
+			right, err := ParseVersion(b)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(left.Compare(*right)).To(gomega.Equal(expected))
+			gomega.Expect(right.Compare(*left)).To(gomega.Equal(-expected))
+		},
+		table.Entry("equal", "v1.2.3", "1.2.3", 0),
+		table.Entry("major", "v1.9.9", "v2.0.0", -1),
+		table.Entry("minor", "v1.10.0", "v1.9.0", 1),
+		table.Entry("patch", "v1.0.1", "v1.0.2", -1),
+		table.Entry("pre-release", "v1.0.0-rc.1", "v1.0.0", -1),
+		table.Entry("numeric pre-release", "v1.0.0-rc.2", "v1.0.0-rc.10", -1),
+		table.Entry("alphanumeric pre-release", "v1.0.0-alpha", "v1.0.0-beta", -1),
+		table.Entry("numeric lower than alphanumeric", "v1.0.0-1", "v1.0.0-alpha", -1),
+		table.Entry("longer pre-release", "v1.0.0-alpha", "v1.0.0-alpha.1", -1),
+	)
+})
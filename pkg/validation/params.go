@@ -16,7 +16,19 @@
 
 package validation
 
-import "github.com/napptive/nerrors/pkg/nerrors"
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// MaxPort with the highest valid TCP/UDP port.
+const MaxPort = 65535
+
+// hostnameLabelRegex validates each label of a hostname following RFC 1123.
+var hostnameLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
 
 // CheckNotEmpty returns an error if the given attribute is empty.
 func CheckNotEmpty(attribute string, attributeName string) error {
@@ -33,3 +45,28 @@ func CheckPositive(attribute int, attributeName string) error {
 	}
 	return nil
 }
+
+// CheckPort returns an error if the given value is not a valid port number.
+func CheckPort(attribute int, attributeName string) error {
+	if attribute <= 0 || attribute > MaxPort {
+		return nerrors.NewInvalidArgumentError("%s must be between 1 and %d", attributeName, MaxPort)
+	}
+	return nil
+}
+
+// CheckHost returns an error if the given value is neither a valid hostname nor an IP address.
+func CheckHost(attribute string, attributeName string) error {
+	if net.ParseIP(attribute) != nil {
+		return nil
+	}
+	hostname := strings.TrimSuffix(attribute, ".")
+	if hostname == "" || len(hostname) > 253 {
+		return nerrors.NewInvalidArgumentError("%s must be a valid hostname or IP address", attributeName)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !hostnameLabelRegex.MatchString(label) {
+			return nerrors.NewInvalidArgumentError("%s must be a valid hostname or IP address", attributeName)
+		}
+	}
+	return nil
+}
@@ -35,4 +35,23 @@ var _ = ginkgo.Describe("Param validation tests", func() {
 		gomega.Expect(CheckPositive(-1, "name")).To(gomega.HaveOccurred())
 	})
 
+	ginkgo.It("should fail on ports out of range", func() {
+		gomega.Expect(CheckPort(0, "port")).To(gomega.HaveOccurred())
+		gomega.Expect(CheckPort(MaxPort+1, "port")).To(gomega.HaveOccurred())
+		gomega.Expect(CheckPort(443, "port")).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept hostnames and IP addresses", func() {
+		gomega.Expect(CheckHost("playground.napptive.dev", "host")).To(gomega.Succeed())
+		gomega.Expect(CheckHost("localhost", "host")).To(gomega.Succeed())
+		gomega.Expect(CheckHost("10.0.0.1", "host")).To(gomega.Succeed())
+		gomega.Expect(CheckHost("::1", "host")).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should fail on invalid hosts", func() {
+		gomega.Expect(CheckHost("under_score.napptive.dev", "host")).To(gomega.HaveOccurred())
+		gomega.Expect(CheckHost("-invalid.napptive.dev", "host")).To(gomega.HaveOccurred())
+		gomega.Expect(CheckHost("host:443", "host")).To(gomega.HaveOccurred())
+	})
+
 })
@@ -0,0 +1,99 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// FieldViolation describes a problem found in a given field.
+type FieldViolation struct {
+	// Field with the name of the invalid field.
+	Field string `json:"field"`
+	// Description of the problem.
+	Description string `json:"description"`
+}
+
+// FieldViolations is an error that contains all the problems found validating an entity.
+type FieldViolations []FieldViolation
+
+// Error returns the description of all the violations.
+func (fv FieldViolations) Error() string {
+	descriptions := make([]string, 0, len(fv))
+	for _, violation := range fv {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", violation.Field, violation.Description))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// Violations collects the problems found validating an entity so that all of them can be reported at once.
+type Violations struct {
+	fields FieldViolations
+}
+
+// NewViolations creates an empty Violations collector.
+func NewViolations() *Violations {
+	return &Violations{fields: make(FieldViolations, 0)}
+}
+
+// Check adds a violation for the given field if err is not nil.
+func (v *Violations) Check(field string, err error) {
+	if err == nil {
+		return
+	}
+	description := err.Error()
+	var extended *nerrors.ExtendedError
+	if errors.As(err, &extended) {
+		description = extended.Msg
+		if extended.From != nil {
+			description = fmt.Sprintf("%s: %s", description, extended.From.Error())
+		}
+	}
+	v.fields = append(v.fields, FieldViolation{Field: field, Description: description})
+}
+
+// Add adds a violation for the given field.
+func (v *Violations) Add(field string, format string, a ...interface{}) {
+	v.fields = append(v.fields, FieldViolation{Field: field, Description: fmt.Sprintf(format, a...)})
+}
+
+// Empty returns true if no violation has been found.
+func (v *Violations) Empty() bool {
+	return len(v.fields) == 0
+}
+
+// ToError returns nil if no violation has been found, or an InvalidArgument error with the given message that
+// contains the FieldViolations as its cause.
+func (v *Violations) ToError(format string, a ...interface{}) error {
+	if v.Empty() {
+		return nil
+	}
+	return nerrors.NewInvalidArgumentErrorFrom(v.fields, format, a...)
+}
+
+// GetFieldViolations extracts the FieldViolations contained in an error returned by Violations.ToError.
+func GetFieldViolations(err error) FieldViolations {
+	var violations FieldViolations
+	if errors.As(err, &violations) {
+		return violations
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validation
+
+import (
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Violations tests", func() {
+
+	ginkgo.It("should return nil without violations", func() {
+		violations := NewViolations()
+		violations.Check("name", nil)
+		gomega.Expect(violations.Empty()).To(gomega.BeTrue())
+		gomega.Expect(violations.ToError("invalid entity")).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should aggregate all the violations", func() {
+		violations := NewViolations()
+		violations.Check("name", CheckNotEmpty("", "name"))
+		violations.Add("port", "must be lower than %d", 10)
+		err := violations.ToError("invalid entity")
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		gomega.Expect(nerrors.FromError(err).Code).To(gomega.Equal(nerrors.InvalidArgument))
+		gomega.Expect(GetFieldViolations(err)).To(gomega.Equal(FieldViolations{
+			{Field: "name", Description: "name cannot be empty"},
+			{Field: "port", Description: "must be lower than 10"},
+		}))
+	})
+
+})